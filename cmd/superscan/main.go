@@ -1,27 +1,47 @@
 package main
 
 import (
+    "context"
     "encoding/json"
     "flag"
     "fmt"
     "log"
     "os"
+    "path/filepath"
     "strings"
     "time"
 
     "gopkg.in/yaml.v3"
 
+    "superscan/internal/git"
+    "superscan/internal/glob"
     "superscan/internal/report"
     "superscan/internal/rules"
     "superscan/internal/scanner"
+    "superscan/internal/verify"
 )
 
+type ArchiveConfig struct {
+    MaxDepth             int   `yaml:"max_depth"`
+    MaxDecompressedBytes int64 `yaml:"max_decompressed_bytes"`
+}
+
+type DecodingConfig struct {
+    MaxDepth int `yaml:"max_depth"`
+}
+
 type Config struct {
-    IgnoreDirs       []string                  `yaml:"ignore_dirs"`
-    MaxFileSizeBytes int64                     `yaml:"max_file_size_bytes"`
-    SensitiveFiles   []string                  `yaml:"sensitive_filenames"`
-    PatternRules     []rules.PatternRuleConfig `yaml:"patterns"`
-    EntropyRules     []rules.EntropyRuleConfig `yaml:"entropy_rules"`
+    IgnoreDirs       []string                    `yaml:"ignore_dirs"`
+    IgnorePaths      []string                    `yaml:"ignore_paths"`
+    MaxFileSizeBytes int64                       `yaml:"max_file_size_bytes"`
+    SensitiveFiles   []string                    `yaml:"sensitive_filenames"`
+    PatternRules     []rules.PatternRuleConfig   `yaml:"patterns"`
+    EntropyRules     []rules.EntropyRuleConfig   `yaml:"entropy_rules"`
+    CompositeRules   []rules.CompositeRuleConfig `yaml:"composite_rules"`
+    Verify           verify.Config               `yaml:"verify"`
+    Archives         ArchiveConfig               `yaml:"archives"`
+    Decoding         DecodingConfig              `yaml:"decoding"`
+    Allowlist        rules.AllowlistConfig       `yaml:"allowlist"`
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -36,6 +56,27 @@ func loadConfig(path string) (*Config, error) {
     return &cfg, nil
 }
 
+func revisionProvenance(repoPath, rev string) (report.VersionControlDetails, error) {
+    repo, err := git.Open(repoPath)
+    if err != nil {
+        return report.VersionControlDetails{}, err
+    }
+    defer repo.Close()
+
+    if rev == "" {
+        rev = "HEAD"
+    }
+    h, err := repo.Resolve(rev)
+    if err != nil {
+        return report.VersionControlDetails{}, err
+    }
+    uri := repo.RemoteURL("origin")
+    if uri == "" {
+        uri = "file://" + filepath.ToSlash(repo.WorkTree)
+    }
+    return report.VersionControlDetails{RepositoryUri: uri, RevisionId: h.String()}, nil
+}
+
 func main() {
     var (
         configPath     string
@@ -44,6 +85,16 @@ func main() {
         workers        int
         baselinePath   string
         createBaseline bool
+        baselineCtx    bool
+        gitHistory     bool
+        staged         bool
+        since          string
+        until          string
+        verifyLive     bool
+        redact         bool
+        showSuppressed bool
+        noGitignore    bool
+        noPrefilter    bool
     )
 
     flag.StringVar(&configPath, "config", "config.yml", "Path to YAML config")
@@ -52,36 +103,93 @@ func main() {
     flag.IntVar(&workers, "workers", 8, "Number of concurrent workers")
     flag.StringVar(&baselinePath, "baseline", "", "Path to baseline JSON (ignore known findings)")
     flag.BoolVar(&createBaseline, "baseline-create", false, "Create baseline file from current scan (use with --baseline)")
+    flag.BoolVar(&baselineCtx, "baseline-context", false, "With --baseline-create, only ignore a finding while the code around it is unchanged")
+    flag.BoolVar(&gitHistory, "git-history", false, "Scan lines added by every commit in the git repository at <path>")
+    flag.BoolVar(&staged, "staged", false, "Scan only lines added in the git index (for pre-commit hooks); <path> defaults to .")
+    flag.StringVar(&since, "since", "", "Scan only commits after this git ref (e.g. the PR base)")
+    flag.StringVar(&until, "until", "", "Scan commits up to this git ref (default HEAD when --since is set)")
+    flag.BoolVar(&verifyLive, "verify", false, "Check whether found credentials are live against their provider (network access)")
+    flag.BoolVar(&redact, "redact", os.Getenv("CI") != "", "Mask the middle of matched secrets in all output (default on when $CI is set)")
+    flag.BoolVar(&showSuppressed, "show-suppressed", false, "Also report findings silenced by superscan:ignore comments, for auditing")
+    flag.BoolVar(&noGitignore, "no-gitignore", false, "Scan files matched by .gitignore (.superscanignore is still honored)")
+    flag.BoolVar(&noPrefilter, "no-prefilter", false, "Run every pattern on every line instead of only rules whose keywords appear (for benchmarking)")
     flag.Parse()
 
-    if flag.NArg() < 1 {
+    // `superscan [options] image [options] <path>` scans a container image
+    // instead of a tree; a directory named image is scanned as ./image
+    imageMode := flag.Arg(0) == "image"
+    if imageMode {
+        flag.CommandLine.Parse(flag.Args()[1:])
+    }
+
+    rootPath := flag.Arg(0)
+    if rootPath == "" && staged {
+        rootPath = "."
+    }
+    if rootPath == "" {
         fmt.Println("Usage: superscan [options] <path>")
+        fmt.Println("       superscan image [options] <oci-layout-dir | oci-archive.tar | docker-save.tar>")
         flag.PrintDefaults()
         os.Exit(1)
     }
 
-    rootPath := flag.Arg(0)
-
     cfg, err := loadConfig(configPath)
     if err != nil {
         log.Fatalf("failed to load config: %v", err)
     }
 
-    ruleSet, err := rules.NewRuleSet(cfg.SensitiveFiles, cfg.PatternRules, cfg.EntropyRules)
+    ruleSet, err := rules.NewRuleSet(cfg.SensitiveFiles, cfg.PatternRules, cfg.EntropyRules, cfg.Allowlist)
     if err != nil {
         log.Fatalf("failed to build rule set: %v", err)
     }
+    if err := ruleSet.AddCompositeRules(cfg.CompositeRules); err != nil {
+        log.Fatalf("failed to build rule set: %v", err)
+    }
+    ruleSet.NoPrefilter = noPrefilter
+    ruleSet.MaxDecodeDepth = cfg.Decoding.MaxDepth
+
+    for _, p := range cfg.IgnorePaths {
+        if err := glob.Validate(p); err != nil {
+            log.Fatalf("bad ignore_paths glob %q: %v", p, err)
+        }
+    }
 
     opts := scanner.Options{
         IgnoreDirs:       cfg.IgnoreDirs,
+        IgnorePaths:      cfg.IgnorePaths,
         MaxFileSizeBytes: cfg.MaxFileSizeBytes,
         Workers:          workers,
+        MaxArchiveDepth:  cfg.Archives.MaxDepth,
+        MaxArchiveBytes:  cfg.Archives.MaxDecompressedBytes,
+        NoGitignore:      noGitignore,
     }
 
     start := time.Now()
-    findings, scanErr := scanner.Scan(rootPath, ruleSet, opts)
+    var findings []scanner.Finding
+    var scanErr error
+    switch {
+    case imageMode:
+        findings, scanErr = scanner.ScanImage(rootPath, ruleSet, opts)
+    case staged:
+        findings, scanErr = scanner.ScanStaged(rootPath, ruleSet, opts)
+    case since != "" || until != "":
+        findings, scanErr = scanner.ScanRange(rootPath, since, until, ruleSet, opts)
+    case gitHistory:
+        findings, scanErr = scanner.ScanHistory(rootPath, ruleSet, opts)
+    default:
+        findings, scanErr = scanner.Scan(rootPath, ruleSet, opts)
+    }
     duration := time.Since(start)
 
+    // git modes fail before scanning anything (bad ref, not a repo), so an
+    // error there must not look like a clean result
+    gitMode := staged || gitHistory || since != "" || until != ""
+    if scanErr != nil && gitMode {
+        log.Fatalf("git scan failed: %v", scanErr)
+    }
+    if scanErr != nil && imageMode {
+        log.Fatalf("image scan failed: %v", scanErr)
+    }
     if scanErr != nil {
         log.Printf("scan completed with errors: %v", scanErr)
     }
@@ -91,6 +199,11 @@ func main() {
         findings[i].Fingerprint = scanner.BuildFingerprint(findings[i])
     }
 
+    // Skipped files and inline superscan:ignore findings never count, but
+    // stay reportable
+    findings, skipped := scanner.SplitSkipped(findings)
+    findings, suppressed := scanner.SplitSuppressed(findings)
+
     var baseline *scanner.Baseline
     if baselinePath != "" && !createBaseline {
         b, err := scanner.LoadBaseline(baselinePath)
@@ -111,22 +224,59 @@ func main() {
         filtered = tmp
     }
 
+    // Findings that together satisfy a composite rule become one finding.
+    // Only new, unsuppressed findings are grouped, so a baselined pair does
+    // not come back as a composite; the baseline keeps the parts.
+    filtered = scanner.Correlate(filtered, ruleSet)
+    for i := range filtered {
+        if filtered[i].Type == "composite" {
+            filtered[i].Fingerprint = scanner.BuildFingerprint(filtered[i])
+        }
+    }
+
+    if baseline.Migrated() {
+        if err := baseline.Save(baselinePath); err != nil {
+            log.Fatalf("failed to update baseline: %v", err)
+        }
+        log.Printf("Baseline %s migrated to version %d", baselinePath, scanner.BaselineVersion)
+    }
+
+    if verifyLive || cfg.Verify.Enabled {
+        engine, err := verify.NewEngine(cfg.Verify, nil)
+        if err != nil {
+            log.Fatalf("failed to set up verification: %v", err)
+        }
+        engine.Run(context.Background(), filtered)
+    }
+
     if createBaseline {
         if baselinePath == "" {
             log.Fatalf("--baseline-create requires --baseline <path>")
         }
-        if err := scanner.WriteBaseline(baselinePath, findings); err != nil {
+        if err := scanner.WriteBaseline(baselinePath, findings, baselineCtx); err != nil {
             log.Fatalf("failed to write baseline: %v", err)
         }
         log.Printf("Baseline written to %s", baselinePath)
     }
 
+    if redact {
+        filtered = report.Redact(filtered)
+        suppressed = report.Redact(suppressed)
+    }
+
+    reported := filtered
+    if showSuppressed {
+        reported = append(append([]scanner.Finding(nil), filtered...), suppressed...)
+    }
+
     // Output
     if jsonOut {
         out := report.JSONReport{
-            RootPath: rootPath,
-            Duration: duration.String(),
-            Findings: filtered,
+            RootPath:   rootPath,
+            Duration:   duration.String(),
+            Findings:   filtered,
+            Suppressed: suppressed,
+            Skipped:    skipped,
         }
         enc := json.NewEncoder(os.Stdout)
         enc.SetIndent("", "  ")
@@ -134,14 +284,21 @@ func main() {
             log.Fatalf("failed to write JSON: %v", err)
         }
     } else if sarifOut {
-        sarif := report.GenerateSARIF(filtered)
+        sarif := report.GenerateSARIF(reported)
+        if since != "" || until != "" {
+            vcs, err := revisionProvenance(rootPath, until)
+            if err != nil {
+                log.Fatalf("failed to resolve revision: %v", err)
+            }
+            sarif.Runs[0].VersionControlProvenance = []report.VersionControlDetails{vcs}
+        }
         enc := json.NewEncoder(os.Stdout)
         enc.SetIndent("", "  ")
         if err := enc.Encode(sarif); err != nil {
             log.Fatalf("failed to write SARIF: %v", err)
         }
     } else {
-        report.PrintTextReport(rootPath, duration, filtered)
+        report.PrintTextReport(rootPath, duration, reported, skipped)
     }
 
     // Exit codes based on severity
@@ -0,0 +1,147 @@
+package git
+
+import (
+    "bytes"
+)
+
+// maxDiffEdits bounds the Myers search. Past it the rewrite is so large that
+// an exact alignment buys nothing, and every new line not present verbatim
+// in the old content is reported as added instead.
+const maxDiffEdits = 1000
+
+// SplitLines splits content the way bufio.ScanLines does: on '\n', with a
+// trailing '\r' dropped and no empty element after a final newline.
+func SplitLines(data []byte) []string {
+    if len(data) == 0 {
+        return nil
+    }
+    parts := bytes.Split(data, []byte{'\n'})
+    if len(parts[len(parts)-1]) == 0 {
+        parts = parts[:len(parts)-1]
+    }
+    lines := make([]string, len(parts))
+    for i, p := range parts {
+        lines[i] = string(bytes.TrimSuffix(p, []byte{'\r'}))
+    }
+    return lines
+}
+
+// AddedLines returns the 0-based indices of lines in b that a line diff
+// from a to b marks as inserted.
+func AddedLines(a, b []string) []int {
+    prefix := 0
+    for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+        prefix++
+    }
+    suffix := 0
+    for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+        a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+        suffix++
+    }
+
+    am := a[prefix : len(a)-suffix]
+    bm := b[prefix : len(b)-suffix]
+
+    var added []int
+    if len(am) == 0 {
+        for i := range bm {
+            added = append(added, prefix+i)
+        }
+        return added
+    }
+
+    inserted, ok := myersInsertions(am, bm)
+    if !ok {
+        inserted = unmatchedLines(am, bm)
+    }
+    for _, i := range inserted {
+        added = append(added, prefix+i)
+    }
+    return added
+}
+
+func myersInsertions(a, b []string) ([]int, bool) {
+    n, m := len(a), len(b)
+    max := n + m
+    if max > maxDiffEdits {
+        max = maxDiffEdits
+    }
+    offset := max + 1
+    v := make([]int, 2*max+3)
+    var trace [][]int
+
+    found := false
+    for d := 0; d <= max && !found; d++ {
+        // round d only reads diagonals -d-1..d+1 of the previous round
+        snapshot := make([]int, 2*d+3)
+        copy(snapshot, v[offset-d-1:offset+d+2])
+        trace = append(trace, snapshot)
+
+        for k := -d; k <= d; k += 2 {
+            var x int
+            if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+                x = v[offset+k+1]
+            } else {
+                x = v[offset+k-1] + 1
+            }
+            y := x - k
+            for x < n && y < m && a[x] == b[y] {
+                x++
+                y++
+            }
+            v[offset+k] = x
+            if x >= n && y >= m {
+                found = true
+                break
+            }
+        }
+    }
+    if !found {
+        return nil, false
+    }
+
+    var inserted []int
+    x, y := n, m
+    for d := len(trace) - 1; d > 0; d-- {
+        prev := trace[d]
+        at := func(k int) int { return prev[k+d+1] }
+        k := x - y
+        var prevK int
+        if k == -d || (k != d && at(k-1) < at(k+1)) {
+            prevK = k + 1
+        } else {
+            prevK = k - 1
+        }
+        prevX := at(prevK)
+        prevY := prevX - prevK
+        for x > prevX && y > prevY {
+            x--
+            y--
+        }
+        if x == prevX {
+            inserted = append(inserted, prevY)
+        }
+        x, y = prevX, prevY
+    }
+
+    for i, j := 0, len(inserted)-1; i < j; i, j = i+1, j-1 {
+        inserted[i], inserted[j] = inserted[j], inserted[i]
+    }
+    return inserted, true
+}
+
+func unmatchedLines(a, b []string) []int {
+    counts := make(map[string]int, len(a))
+    for _, l := range a {
+        counts[l]++
+    }
+    var out []int
+    for i, l := range b {
+        if counts[l] > 0 {
+            counts[l]--
+            continue
+        }
+        out = append(out, i)
+    }
+    return out
+}
@@ -0,0 +1,153 @@
+package git
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+)
+
+type IndexEntry struct {
+    Path string
+    Mode uint32
+    Hash Hash
+}
+
+func (e IndexEntry) IsFile() bool {
+    return TreeEntry{Mode: e.Mode}.IsFile()
+}
+
+const (
+    indexFlagExtended = 0x4000
+    indexStageMask    = 0x3000
+    indexNameMask     = 0x0fff
+)
+
+// ReadIndex parses the staging area (.git/index), returning only stage 0
+// entries; unresolved merge conflicts have nothing committable yet.
+func (r *Repo) ReadIndex() ([]IndexEntry, error) {
+    data, err := os.ReadFile(filepath.Join(r.GitDir, "index"))
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil, nil
+        }
+        return nil, err
+    }
+    if len(data) < 12 || string(data[:4]) != "DIRC" {
+        return nil, errors.New("bad index signature")
+    }
+    version := binary.BigEndian.Uint32(data[4:8])
+    if version < 2 || version > 4 {
+        return nil, fmt.Errorf("unsupported index version %d", version)
+    }
+    count := int(binary.BigEndian.Uint32(data[8:12]))
+
+    var entries []IndexEntry
+    var prevName []byte
+    pos := 12
+    for i := 0; i < count; i++ {
+        start := pos
+        if len(data) < pos+62 {
+            return nil, errors.New("truncated index")
+        }
+        mode := binary.BigEndian.Uint32(data[pos+24:])
+        var h Hash
+        copy(h[:], data[pos+40:pos+60])
+        flags := binary.BigEndian.Uint16(data[pos+60:])
+        pos += 62
+        if version >= 3 && flags&indexFlagExtended != 0 {
+            pos += 2
+        }
+
+        var name []byte
+        if version == 4 {
+            strip, n := indexVarint(data[pos:])
+            if n == 0 || int(strip) > len(prevName) {
+                return nil, errors.New("malformed index path")
+            }
+            pos += n
+            nul := bytes.IndexByte(data[pos:], 0)
+            if nul < 0 {
+                return nil, errors.New("truncated index")
+            }
+            name = append(append([]byte(nil), prevName[:len(prevName)-int(strip)]...), data[pos:pos+nul]...)
+            pos += nul + 1
+        } else {
+            nameLen := int(flags & indexNameMask)
+            if nameLen == indexNameMask {
+                nameLen = bytes.IndexByte(data[pos:], 0)
+            }
+            if nameLen < 0 || len(data) < pos+nameLen {
+                return nil, errors.New("truncated index")
+            }
+            name = data[pos : pos+nameLen]
+            // entries are NUL padded to a multiple of eight bytes
+            pos = start + ((pos+nameLen-start)+8)&^7
+        }
+        prevName = name
+
+        if flags&indexStageMask != 0 {
+            continue
+        }
+        entries = append(entries, IndexEntry{Path: string(name), Mode: mode, Hash: h})
+    }
+    return entries, nil
+}
+
+func indexVarint(b []byte) (uint64, int) {
+    if len(b) == 0 {
+        return 0, 0
+    }
+    c := b[0]
+    v := uint64(c & 0x7f)
+    i := 1
+    for c&0x80 != 0 {
+        if i >= len(b) {
+            return 0, 0
+        }
+        c = b[i]
+        i++
+        v = ((v + 1) << 7) | uint64(c&0x7f)
+    }
+    return v, i
+}
+
+// Head returns the commit HEAD points at, or the zero hash on an unborn
+// branch.
+func (r *Repo) Head() (Hash, error) {
+    h, err := r.resolveRef("HEAD", 0)
+    if err != nil {
+        return ZeroHash, nil
+    }
+    return h, nil
+}
+
+// TreeFiles flattens a tree into a map of slash-separated path to blob.
+func (r *Repo) TreeFiles(h Hash) (map[string]Hash, error) {
+    files := make(map[string]Hash)
+    if h.IsZero() {
+        return files, nil
+    }
+    err := r.treeFiles(h, "", files)
+    return files, err
+}
+
+func (r *Repo) treeFiles(h Hash, prefix string, files map[string]Hash) error {
+    entries, err := r.ReadTree(h)
+    if err != nil {
+        return err
+    }
+    for _, e := range entries {
+        switch {
+        case e.IsDir():
+            if err := r.treeFiles(e.Hash, prefix+e.Name+"/", files); err != nil {
+                return err
+            }
+        case e.IsFile():
+            files[prefix+e.Name] = e.Hash
+        }
+    }
+    return nil
+}
@@ -0,0 +1,349 @@
+package git
+
+import (
+    "bytes"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+type Signature struct {
+    Name  string
+    Email string
+    When  time.Time
+}
+
+type Commit struct {
+    Hash      Hash
+    Tree      Hash
+    Parents   []Hash
+    Author    Signature
+    Committer Signature
+    Message   string
+}
+
+func (r *Repo) ReadCommit(h Hash) (*Commit, error) {
+    data, err := r.readTyped(h, ObjCommit)
+    if err != nil {
+        return nil, err
+    }
+    c, err := parseCommit(data)
+    if err != nil {
+        return nil, fmt.Errorf("commit %s: %w", h, err)
+    }
+    c.Hash = h
+    if r.shallow[h] {
+        c.Parents = nil
+    }
+    return c, nil
+}
+
+func parseCommit(data []byte) (*Commit, error) {
+    c := &Commit{}
+    for len(data) > 0 {
+        nl := bytes.IndexByte(data, '\n')
+        if nl < 0 {
+            nl = len(data)
+        }
+        line := string(data[:nl])
+        if nl < len(data) {
+            data = data[nl+1:]
+        } else {
+            data = nil
+        }
+        if line == "" {
+            c.Message = string(data)
+            break
+        }
+        // continuation lines of multi-line headers (gpgsig, mergetag)
+        if strings.HasPrefix(line, " ") {
+            continue
+        }
+
+        key, value, _ := strings.Cut(line, " ")
+        switch key {
+        case "tree":
+            h, err := ParseHash(value)
+            if err != nil {
+                return nil, err
+            }
+            c.Tree = h
+        case "parent":
+            h, err := ParseHash(value)
+            if err != nil {
+                return nil, err
+            }
+            c.Parents = append(c.Parents, h)
+        case "author":
+            c.Author = parseSignature(value)
+        case "committer":
+            c.Committer = parseSignature(value)
+        }
+    }
+    if c.Tree.IsZero() {
+        return nil, errors.New("missing tree header")
+    }
+    return c, nil
+}
+
+func parseSignature(s string) Signature {
+    var sig Signature
+    lt := strings.IndexByte(s, '<')
+    gt := strings.LastIndexByte(s, '>')
+    if lt < 0 || gt < lt {
+        sig.Name = strings.TrimSpace(s)
+        return sig
+    }
+    sig.Name = strings.TrimSpace(s[:lt])
+    sig.Email = s[lt+1 : gt]
+
+    fields := strings.Fields(s[gt+1:])
+    if len(fields) == 0 {
+        return sig
+    }
+    secs, err := strconv.ParseInt(fields[0], 10, 64)
+    if err != nil {
+        return sig
+    }
+    loc := time.UTC
+    if len(fields) > 1 && len(fields[1]) == 5 {
+        tz := fields[1]
+        hh, err1 := strconv.Atoi(tz[1:3])
+        mm, err2 := strconv.Atoi(tz[3:5])
+        if err1 == nil && err2 == nil {
+            offset := hh*3600 + mm*60
+            if tz[0] == '-' {
+                offset = -offset
+            }
+            loc = time.FixedZone(tz, offset)
+        }
+    }
+    sig.When = time.Unix(secs, 0).In(loc)
+    return sig
+}
+
+type TreeEntry struct {
+    Name string
+    Mode uint32
+    Hash Hash
+}
+
+const (
+    modeDir      = 0o040000
+    modeSymlink  = 0o120000
+    modeGitlink  = 0o160000
+    modeTypeMask = 0o170000
+)
+
+func (e TreeEntry) IsDir() bool {
+    return e.Mode&modeTypeMask == modeDir
+}
+
+// IsFile reports whether the entry is a regular file blob. Symlinks and
+// submodule links carry no scannable content of their own.
+func (e TreeEntry) IsFile() bool {
+    t := e.Mode & modeTypeMask
+    return t != modeDir && t != modeSymlink && t != modeGitlink
+}
+
+func (r *Repo) ReadTree(h Hash) ([]TreeEntry, error) {
+    data, err := r.readTyped(h, ObjTree)
+    if err != nil {
+        return nil, err
+    }
+    var entries []TreeEntry
+    for len(data) > 0 {
+        sp := bytes.IndexByte(data, ' ')
+        if sp < 0 {
+            return nil, fmt.Errorf("tree %s: malformed entry", h)
+        }
+        mode, err := strconv.ParseUint(string(data[:sp]), 8, 32)
+        if err != nil {
+            return nil, fmt.Errorf("tree %s: bad mode: %w", h, err)
+        }
+        data = data[sp+1:]
+        nul := bytes.IndexByte(data, 0)
+        if nul < 0 || len(data) < nul+1+20 {
+            return nil, fmt.Errorf("tree %s: malformed entry", h)
+        }
+        e := TreeEntry{Name: string(data[:nul]), Mode: uint32(mode)}
+        copy(e.Hash[:], data[nul+1:nul+21])
+        entries = append(entries, e)
+        data = data[nul+21:]
+    }
+    return entries, nil
+}
+
+// Change is a file whose content differs between two trees. From is the
+// zero hash when the file was added.
+type Change struct {
+    Path string
+    From Hash
+    To   Hash
+}
+
+// DiffTrees lists files that were added or modified going from tree a to
+// tree b. Deletions are omitted since they cannot introduce content. A zero
+// hash for a means the empty tree.
+func (r *Repo) DiffTrees(a, b Hash) ([]Change, error) {
+    var out []Change
+    err := r.diffTrees(a, b, "", &out)
+    return out, err
+}
+
+func (r *Repo) diffTrees(a, b Hash, prefix string, out *[]Change) error {
+    if a == b {
+        return nil
+    }
+    var oldEntries []TreeEntry
+    if !a.IsZero() {
+        var err error
+        if oldEntries, err = r.ReadTree(a); err != nil {
+            return err
+        }
+    }
+    newEntries, err := r.ReadTree(b)
+    if err != nil {
+        return err
+    }
+
+    old := make(map[string]TreeEntry, len(oldEntries))
+    for _, e := range oldEntries {
+        old[e.Name] = e
+    }
+
+    for _, e := range newEntries {
+        path := prefix + e.Name
+        prev, existed := old[e.Name]
+        if existed && prev.Hash == e.Hash && prev.Mode == e.Mode {
+            continue
+        }
+        switch {
+        case e.IsDir():
+            var from Hash
+            if existed && prev.IsDir() {
+                from = prev.Hash
+            }
+            if err := r.diffTrees(from, e.Hash, path+"/", out); err != nil {
+                return err
+            }
+        case e.IsFile():
+            var from Hash
+            if existed && prev.IsFile() {
+                if prev.Hash == e.Hash {
+                    continue
+                }
+                from = prev.Hash
+            }
+            *out = append(*out, Change{Path: path, From: from, To: e.Hash})
+        }
+    }
+    return nil
+}
+
+type Ref struct {
+    Name string
+    Hash Hash
+}
+
+// Refs lists every branch, tag and remote-tracking ref, plus HEAD.
+func (r *Repo) Refs() ([]Ref, error) {
+    refs := make(map[string]Hash)
+    common := commonDir(r.GitDir)
+
+    if data, err := readFileString(common, "packed-refs"); err == nil {
+        for _, line := range strings.Split(data, "\n") {
+            if line == "" || line[0] == '#' || line[0] == '^' {
+                continue
+            }
+            hash, name, ok := strings.Cut(line, " ")
+            if !ok {
+                continue
+            }
+            if h, err := ParseHash(hash); err == nil {
+                refs[name] = h
+            }
+        }
+    }
+
+    if err := walkLooseRefs(common, "refs", refs); err != nil {
+        return nil, err
+    }
+    if h, err := r.resolveRef("HEAD", 0); err == nil {
+        refs["HEAD"] = h
+    }
+
+    out := make([]Ref, 0, len(refs))
+    for name, h := range refs {
+        out = append(out, Ref{Name: name, Hash: h})
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+    return out, nil
+}
+
+// Peel follows annotated tags until it reaches a commit.
+func (r *Repo) Peel(h Hash) (Hash, error) {
+    for i := 0; i < 16; i++ {
+        typ, data, err := r.ReadObject(h)
+        if err != nil {
+            return h, err
+        }
+        switch typ {
+        case ObjCommit:
+            return h, nil
+        case ObjTag:
+            line, _, _ := strings.Cut(string(data), "\n")
+            target, ok := strings.CutPrefix(line, "object ")
+            if !ok {
+                return h, fmt.Errorf("tag %s: missing object header", h)
+            }
+            if h, err = ParseHash(target); err != nil {
+                return h, err
+            }
+        default:
+            return h, fmt.Errorf("%s is a %s, not a commit", h, typ)
+        }
+    }
+    return h, errors.New("tag chain too deep")
+}
+
+// Log returns the commits reachable from any of from, excluding commits
+// reachable from any of exclude, newest first.
+func (r *Repo) Log(from, exclude []Hash) ([]*Commit, error) {
+    hidden := make(map[Hash]bool)
+    if err := r.walk(exclude, func(c *Commit) { hidden[c.Hash] = true }, nil); err != nil {
+        return nil, err
+    }
+    var commits []*Commit
+    if err := r.walk(from, func(c *Commit) { commits = append(commits, c) }, hidden); err != nil {
+        return nil, err
+    }
+    sort.SliceStable(commits, func(i, j int) bool {
+        return commits[i].Committer.When.After(commits[j].Committer.When)
+    })
+    return commits, nil
+}
+
+func (r *Repo) walk(start []Hash, visit func(*Commit), stop map[Hash]bool) error {
+    seen := make(map[Hash]bool)
+    queue := append([]Hash(nil), start...)
+    for len(queue) > 0 {
+        h := queue[len(queue)-1]
+        queue = queue[:len(queue)-1]
+        if seen[h] || stop[h] {
+            continue
+        }
+        seen[h] = true
+
+        c, err := r.ReadCommit(h)
+        if err != nil {
+            return err
+        }
+        visit(c)
+        queue = append(queue, c.Parents...)
+    }
+    return nil
+}
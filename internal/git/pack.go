@@ -0,0 +1,347 @@
+package git
+
+import (
+    "bufio"
+    "bytes"
+    "compress/zlib"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "sort"
+    "sync"
+)
+
+const (
+    packOfsDelta = 6
+    packRefDelta = 7
+
+    maxDeltaDepth       = 64
+    maxCachedDeltaBases = 256
+)
+
+type packFile struct {
+    f       *os.File
+    size    int64
+    hashes  []Hash
+    offsets []int64
+
+    mu    sync.Mutex
+    bases map[int64]cachedObject
+}
+
+func openPack(base string) (*packFile, error) {
+    idx, err := os.ReadFile(base + ".idx")
+    if err != nil {
+        return nil, err
+    }
+    p := &packFile{bases: make(map[int64]cachedObject)}
+    if err := p.parseIndex(idx); err != nil {
+        return nil, err
+    }
+
+    f, err := os.Open(base + ".pack")
+    if err != nil {
+        return nil, err
+    }
+    fi, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return nil, err
+    }
+    var header [12]byte
+    if _, err := f.ReadAt(header[:], 0); err != nil {
+        f.Close()
+        return nil, err
+    }
+    if string(header[:4]) != "PACK" {
+        f.Close()
+        return nil, errors.New("bad pack signature")
+    }
+    p.f = f
+    p.size = fi.Size()
+    return p, nil
+}
+
+func (p *packFile) Close() error {
+    if p.f == nil {
+        return nil
+    }
+    return p.f.Close()
+}
+
+func (p *packFile) parseIndex(idx []byte) error {
+    if len(idx) >= 8 && bytes.Equal(idx[:4], []byte{0xff, 't', 'O', 'c'}) {
+        if v := binary.BigEndian.Uint32(idx[4:8]); v != 2 {
+            return fmt.Errorf("unsupported pack index version %d", v)
+        }
+        return p.parseIndexV2(idx[8:])
+    }
+    return p.parseIndexV1(idx)
+}
+
+func (p *packFile) parseIndexV1(idx []byte) error {
+    if len(idx) < 256*4 {
+        return errors.New("truncated pack index")
+    }
+    n := int(binary.BigEndian.Uint32(idx[255*4:]))
+    entries := idx[256*4:]
+    if len(entries) < n*24 {
+        return errors.New("truncated pack index")
+    }
+    p.hashes = make([]Hash, n)
+    p.offsets = make([]int64, n)
+    for i := 0; i < n; i++ {
+        e := entries[i*24:]
+        p.offsets[i] = int64(binary.BigEndian.Uint32(e[:4]))
+        copy(p.hashes[i][:], e[4:24])
+    }
+    return nil
+}
+
+func (p *packFile) parseIndexV2(idx []byte) error {
+    if len(idx) < 256*4 {
+        return errors.New("truncated pack index")
+    }
+    n := int(binary.BigEndian.Uint32(idx[255*4:]))
+    rest := idx[256*4:]
+    if len(rest) < n*(20+4+4) {
+        return errors.New("truncated pack index")
+    }
+
+    names := rest[:n*20]
+    offsets := rest[n*20+n*4 : n*20+n*4+n*4]
+    large := rest[n*20+n*4+n*4:]
+
+    p.hashes = make([]Hash, n)
+    p.offsets = make([]int64, n)
+    for i := 0; i < n; i++ {
+        copy(p.hashes[i][:], names[i*20:(i+1)*20])
+        off := binary.BigEndian.Uint32(offsets[i*4:])
+        if off&0x80000000 != 0 {
+            li := int(off & 0x7fffffff)
+            if len(large) < (li+1)*8 {
+                return errors.New("truncated pack index")
+            }
+            p.offsets[i] = int64(binary.BigEndian.Uint64(large[li*8:]))
+        } else {
+            p.offsets[i] = int64(off)
+        }
+    }
+    return nil
+}
+
+func (p *packFile) find(h Hash) (int64, bool) {
+    i := sort.Search(len(p.hashes), func(i int) bool {
+        return bytes.Compare(p.hashes[i][:], h[:]) >= 0
+    })
+    if i < len(p.hashes) && p.hashes[i] == h {
+        return p.offsets[i], true
+    }
+    return 0, false
+}
+
+func (p *packFile) findPrefix(prefix []byte) []Hash {
+    i := sort.Search(len(p.hashes), func(i int) bool {
+        return bytes.Compare(p.hashes[i][:len(prefix)], prefix) >= 0
+    })
+    var out []Hash
+    for ; i < len(p.hashes) && bytes.Equal(p.hashes[i][:len(prefix)], prefix); i++ {
+        out = append(out, p.hashes[i])
+    }
+    return out
+}
+
+func (p *packFile) readAt(off int64, r *Repo) (ObjectType, []byte, error) {
+    return p.readAtDepth(off, r, 0)
+}
+
+func (p *packFile) readAtDepth(off int64, r *Repo, depth int) (ObjectType, []byte, error) {
+    if depth > maxDeltaDepth {
+        return 0, nil, errors.New("pack delta chain too deep")
+    }
+
+    p.mu.Lock()
+    if c, ok := p.bases[off]; ok {
+        p.mu.Unlock()
+        return c.typ, c.data, nil
+    }
+    p.mu.Unlock()
+
+    br := bufio.NewReader(io.NewSectionReader(p.f, off, p.size-off))
+    c, err := br.ReadByte()
+    if err != nil {
+        return 0, nil, err
+    }
+    kind := int(c>>4) & 7
+    size := int64(c & 0x0f)
+    shift := uint(4)
+    for c&0x80 != 0 {
+        if c, err = br.ReadByte(); err != nil {
+            return 0, nil, err
+        }
+        size |= int64(c&0x7f) << shift
+        shift += 7
+    }
+
+    var typ ObjectType
+    var data []byte
+
+    switch kind {
+    case int(ObjCommit), int(ObjTree), int(ObjBlob), int(ObjTag):
+        typ = ObjectType(kind)
+        data, err = inflate(br, size)
+        if err != nil {
+            return 0, nil, err
+        }
+
+    case packOfsDelta:
+        c, err := br.ReadByte()
+        if err != nil {
+            return 0, nil, err
+        }
+        rel := int64(c & 0x7f)
+        for c&0x80 != 0 {
+            if c, err = br.ReadByte(); err != nil {
+                return 0, nil, err
+            }
+            rel = ((rel + 1) << 7) | int64(c&0x7f)
+        }
+        delta, err := inflate(br, size)
+        if err != nil {
+            return 0, nil, err
+        }
+        baseType, base, err := p.readAtDepth(off-rel, r, depth+1)
+        if err != nil {
+            return 0, nil, err
+        }
+        typ = baseType
+        if data, err = applyDelta(base, delta); err != nil {
+            return 0, nil, err
+        }
+
+    case packRefDelta:
+        var baseHash Hash
+        if _, err := io.ReadFull(br, baseHash[:]); err != nil {
+            return 0, nil, err
+        }
+        delta, err := inflate(br, size)
+        if err != nil {
+            return 0, nil, err
+        }
+        var baseType ObjectType
+        var base []byte
+        if baseOff, ok := p.find(baseHash); ok {
+            baseType, base, err = p.readAtDepth(baseOff, r, depth+1)
+        } else {
+            baseType, base, err = r.ReadObject(baseHash)
+        }
+        if err != nil {
+            return 0, nil, err
+        }
+        typ = baseType
+        if data, err = applyDelta(base, delta); err != nil {
+            return 0, nil, err
+        }
+
+    default:
+        return 0, nil, fmt.Errorf("unknown pack object type %d", kind)
+    }
+
+    // objects at shallow depth are the usual delta bases, keep a few around
+    if depth > 0 {
+        p.mu.Lock()
+        if len(p.bases) >= maxCachedDeltaBases {
+            p.bases = make(map[int64]cachedObject)
+        }
+        p.bases[off] = cachedObject{typ: typ, data: data}
+        p.mu.Unlock()
+    }
+    return typ, data, nil
+}
+
+func inflate(r io.Reader, size int64) ([]byte, error) {
+    zr, err := zlib.NewReader(r)
+    if err != nil {
+        return nil, err
+    }
+    defer zr.Close()
+    buf := make([]byte, size)
+    if _, err := io.ReadFull(zr, buf); err != nil {
+        return nil, err
+    }
+    return buf, nil
+}
+
+func applyDelta(base, delta []byte) ([]byte, error) {
+    srcSize, n := deltaVarint(delta)
+    if n == 0 || int(srcSize) != len(base) {
+        return nil, errors.New("delta base size mismatch")
+    }
+    delta = delta[n:]
+    dstSize, n := deltaVarint(delta)
+    if n == 0 {
+        return nil, errors.New("malformed delta")
+    }
+    delta = delta[n:]
+
+    out := make([]byte, 0, dstSize)
+    for len(delta) > 0 {
+        op := delta[0]
+        delta = delta[1:]
+        if op&0x80 != 0 {
+            var off, size uint32
+            for i := uint(0); i < 4; i++ {
+                if op&(1<<i) != 0 {
+                    if len(delta) == 0 {
+                        return nil, errors.New("malformed delta")
+                    }
+                    off |= uint32(delta[0]) << (8 * i)
+                    delta = delta[1:]
+                }
+            }
+            for i := uint(0); i < 3; i++ {
+                if op&(0x10<<i) != 0 {
+                    if len(delta) == 0 {
+                        return nil, errors.New("malformed delta")
+                    }
+                    size |= uint32(delta[0]) << (8 * i)
+                    delta = delta[1:]
+                }
+            }
+            if size == 0 {
+                size = 0x10000
+            }
+            if uint64(off)+uint64(size) > uint64(len(base)) {
+                return nil, errors.New("delta copy out of range")
+            }
+            out = append(out, base[off:off+size]...)
+        } else if op != 0 {
+            if int(op) > len(delta) {
+                return nil, errors.New("malformed delta")
+            }
+            out = append(out, delta[:op]...)
+            delta = delta[op:]
+        } else {
+            return nil, errors.New("malformed delta")
+        }
+    }
+    if uint64(len(out)) != dstSize {
+        return nil, errors.New("delta result size mismatch")
+    }
+    return out, nil
+}
+
+func deltaVarint(b []byte) (uint64, int) {
+    var v uint64
+    var shift uint
+    for i, c := range b {
+        v |= uint64(c&0x7f) << shift
+        shift += 7
+        if c&0x80 == 0 {
+            return v, i + 1
+        }
+    }
+    return 0, 0
+}
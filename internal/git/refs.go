@@ -0,0 +1,77 @@
+package git
+
+import (
+    "errors"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+const maxSymrefDepth = 8
+
+func readFileString(dir, name string) (string, error) {
+    data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+    if err != nil {
+        return "", err
+    }
+    return string(data), nil
+}
+
+func walkLooseRefs(common, prefix string, refs map[string]Hash) error {
+    root := filepath.Join(common, filepath.FromSlash(prefix))
+    entries, err := os.ReadDir(root)
+    if err != nil {
+        if os.IsNotExist(err) {
+            return nil
+        }
+        return err
+    }
+    for _, e := range entries {
+        name := prefix + "/" + e.Name()
+        if e.IsDir() {
+            if err := walkLooseRefs(common, name, refs); err != nil {
+                return err
+            }
+            continue
+        }
+        data, err := readFileString(common, name)
+        if err != nil {
+            continue
+        }
+        if h, err := ParseHash(strings.TrimSpace(data)); err == nil {
+            refs[name] = h
+        }
+    }
+    return nil
+}
+
+// resolveRef reads a ref by its full name, following symbolic refs. HEAD
+// lives in the per-worktree git dir; everything else in the common dir.
+func (r *Repo) resolveRef(name string, depth int) (Hash, error) {
+    if depth > maxSymrefDepth {
+        return ZeroHash, fmt.Errorf("symbolic ref loop at %s", name)
+    }
+
+    dir := commonDir(r.GitDir)
+    if name == "HEAD" {
+        dir = r.GitDir
+    }
+    if data, err := readFileString(dir, name); err == nil {
+        data = strings.TrimSpace(data)
+        if target, ok := strings.CutPrefix(data, "ref:"); ok {
+            return r.resolveRef(strings.TrimSpace(target), depth+1)
+        }
+        return ParseHash(data)
+    }
+
+    if data, err := readFileString(commonDir(r.GitDir), "packed-refs"); err == nil {
+        for _, line := range strings.Split(data, "\n") {
+            hash, ref, ok := strings.Cut(line, " ")
+            if ok && ref == name {
+                return ParseHash(hash)
+            }
+        }
+    }
+    return ZeroHash, errors.New("ref not found: " + name)
+}
@@ -0,0 +1,337 @@
+package git
+
+import (
+    "bufio"
+    "bytes"
+    "compress/zlib"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+type Hash [20]byte
+
+var ZeroHash Hash
+
+func (h Hash) String() string {
+    return hex.EncodeToString(h[:])
+}
+
+func (h Hash) IsZero() bool {
+    return h == ZeroHash
+}
+
+func ParseHash(s string) (Hash, error) {
+    var h Hash
+    if len(s) != 40 {
+        return h, fmt.Errorf("invalid object id %q", s)
+    }
+    if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+        return h, fmt.Errorf("invalid object id %q", s)
+    }
+    return h, nil
+}
+
+type ObjectType int
+
+const (
+    ObjCommit ObjectType = 1
+    ObjTree   ObjectType = 2
+    ObjBlob   ObjectType = 3
+    ObjTag    ObjectType = 4
+)
+
+func (t ObjectType) String() string {
+    switch t {
+    case ObjCommit:
+        return "commit"
+    case ObjTree:
+        return "tree"
+    case ObjBlob:
+        return "blob"
+    case ObjTag:
+        return "tag"
+    }
+    return "unknown"
+}
+
+func parseObjectType(s string) (ObjectType, error) {
+    switch s {
+    case "commit":
+        return ObjCommit, nil
+    case "tree":
+        return ObjTree, nil
+    case "blob":
+        return ObjBlob, nil
+    case "tag":
+        return ObjTag, nil
+    }
+    return 0, fmt.Errorf("unknown object type %q", s)
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// Repo reads objects straight from a repository's .git directory. Loose
+// objects and pack files are supported; nothing is ever written.
+type Repo struct {
+    WorkTree string
+    GitDir   string
+
+    objectDirs []string
+    packs      []*packFile
+    shallow    map[Hash]bool
+
+    mu    sync.Mutex
+    cache map[Hash]cachedObject
+}
+
+type cachedObject struct {
+    typ  ObjectType
+    data []byte
+}
+
+const maxCachedObjects = 512
+
+func Open(path string) (*Repo, error) {
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return nil, err
+    }
+
+    gitDir, workTree, err := findGitDir(abs)
+    if err != nil {
+        return nil, err
+    }
+
+    r := &Repo{
+        WorkTree: workTree,
+        GitDir:   gitDir,
+        shallow:  make(map[Hash]bool),
+        cache:    make(map[Hash]cachedObject),
+    }
+
+    if cfg, err := os.ReadFile(filepath.Join(gitDir, "config")); err == nil {
+        if bytes.Contains(bytes.ToLower(cfg), []byte("objectformat = sha256")) {
+            return nil, errors.New("sha256 repositories are not supported")
+        }
+    }
+
+    objDir := filepath.Join(commonDir(gitDir), "objects")
+    r.objectDirs = append(r.objectDirs, objDir)
+    if alt, err := os.ReadFile(filepath.Join(objDir, "info", "alternates")); err == nil {
+        for _, line := range strings.Split(string(alt), "\n") {
+            line = strings.TrimSpace(line)
+            if line == "" || strings.HasPrefix(line, "#") {
+                continue
+            }
+            if !filepath.IsAbs(line) {
+                line = filepath.Join(objDir, line)
+            }
+            r.objectDirs = append(r.objectDirs, line)
+        }
+    }
+
+    for _, dir := range r.objectDirs {
+        idxFiles, _ := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+        for _, idx := range idxFiles {
+            p, err := openPack(strings.TrimSuffix(idx, ".idx"))
+            if err != nil {
+                r.Close()
+                return nil, fmt.Errorf("open pack %s: %w", filepath.Base(idx), err)
+            }
+            r.packs = append(r.packs, p)
+        }
+    }
+
+    if data, err := os.ReadFile(filepath.Join(commonDir(gitDir), "shallow")); err == nil {
+        for _, line := range strings.Split(string(data), "\n") {
+            if h, err := ParseHash(strings.TrimSpace(line)); err == nil {
+                r.shallow[h] = true
+            }
+        }
+    }
+
+    return r, nil
+}
+
+func (r *Repo) Close() error {
+    var firstErr error
+    for _, p := range r.packs {
+        if err := p.Close(); err != nil && firstErr == nil {
+            firstErr = err
+        }
+    }
+    return firstErr
+}
+
+func findGitDir(path string) (gitDir, workTree string, err error) {
+    dir := path
+    for {
+        dotGit := filepath.Join(dir, ".git")
+        if fi, err := os.Stat(dotGit); err == nil {
+            if fi.IsDir() {
+                return dotGit, dir, nil
+            }
+            // worktrees and submodules use a ".git" file pointing elsewhere
+            data, err := os.ReadFile(dotGit)
+            if err != nil {
+                return "", "", err
+            }
+            line := strings.TrimSpace(string(data))
+            if !strings.HasPrefix(line, "gitdir:") {
+                return "", "", fmt.Errorf("malformed .git file in %s", dir)
+            }
+            target := strings.TrimSpace(strings.TrimPrefix(line, "gitdir:"))
+            if !filepath.IsAbs(target) {
+                target = filepath.Join(dir, target)
+            }
+            return target, dir, nil
+        }
+        if isBareRepo(dir) {
+            return dir, "", nil
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir {
+            return "", "", fmt.Errorf("not a git repository: %s", path)
+        }
+        dir = parent
+    }
+}
+
+func isBareRepo(dir string) bool {
+    for _, name := range []string{"HEAD", "objects", "refs"} {
+        if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+            return false
+        }
+    }
+    return true
+}
+
+func commonDir(gitDir string) string {
+    data, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+    if err != nil {
+        return gitDir
+    }
+    dir := strings.TrimSpace(string(data))
+    if !filepath.IsAbs(dir) {
+        dir = filepath.Join(gitDir, dir)
+    }
+    return dir
+}
+
+func (r *Repo) ReadObject(h Hash) (ObjectType, []byte, error) {
+    r.mu.Lock()
+    if c, ok := r.cache[h]; ok {
+        r.mu.Unlock()
+        return c.typ, c.data, nil
+    }
+    r.mu.Unlock()
+
+    typ, data, err := r.readObject(h)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    // only trees and commits are worth caching; blobs are read once per diff
+    if typ != ObjBlob {
+        r.mu.Lock()
+        if len(r.cache) >= maxCachedObjects {
+            r.cache = make(map[Hash]cachedObject)
+        }
+        r.cache[h] = cachedObject{typ: typ, data: data}
+        r.mu.Unlock()
+    }
+    return typ, data, nil
+}
+
+func (r *Repo) readObject(h Hash) (ObjectType, []byte, error) {
+    for _, p := range r.packs {
+        if off, ok := p.find(h); ok {
+            return p.readAt(off, r)
+        }
+    }
+    for _, dir := range r.objectDirs {
+        s := h.String()
+        typ, data, err := readLooseObject(filepath.Join(dir, s[:2], s[2:]))
+        if err == nil {
+            return typ, data, nil
+        }
+        if !os.IsNotExist(err) {
+            return 0, nil, fmt.Errorf("read object %s: %w", s, err)
+        }
+    }
+    return 0, nil, fmt.Errorf("%w: %s", ErrObjectNotFound, h)
+}
+
+func (r *Repo) HasObject(h Hash) bool {
+    for _, p := range r.packs {
+        if _, ok := p.find(h); ok {
+            return true
+        }
+    }
+    for _, dir := range r.objectDirs {
+        s := h.String()
+        if _, err := os.Stat(filepath.Join(dir, s[:2], s[2:])); err == nil {
+            return true
+        }
+    }
+    return false
+}
+
+func readLooseObject(path string) (ObjectType, []byte, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return 0, nil, err
+    }
+    defer f.Close()
+
+    zr, err := zlib.NewReader(bufio.NewReader(f))
+    if err != nil {
+        return 0, nil, err
+    }
+    defer zr.Close()
+
+    raw, err := io.ReadAll(zr)
+    if err != nil {
+        return 0, nil, err
+    }
+
+    nul := bytes.IndexByte(raw, 0)
+    if nul < 0 {
+        return 0, nil, errors.New("malformed loose object header")
+    }
+    header := strings.SplitN(string(raw[:nul]), " ", 2)
+    if len(header) != 2 {
+        return 0, nil, errors.New("malformed loose object header")
+    }
+    typ, err := parseObjectType(header[0])
+    if err != nil {
+        return 0, nil, err
+    }
+    size, err := strconv.Atoi(header[1])
+    if err != nil || size != len(raw)-nul-1 {
+        return 0, nil, errors.New("loose object size mismatch")
+    }
+    return typ, raw[nul+1:], nil
+}
+
+func (r *Repo) readTyped(h Hash, want ObjectType) ([]byte, error) {
+    typ, data, err := r.ReadObject(h)
+    if err != nil {
+        return nil, err
+    }
+    if typ != want {
+        return nil, fmt.Errorf("object %s is a %s, not a %s", h, typ, want)
+    }
+    return data, nil
+}
+
+func (r *Repo) ReadBlob(h Hash) ([]byte, error) {
+    return r.readTyped(h, ObjBlob)
+}
@@ -0,0 +1,162 @@
+package git
+
+import (
+    "encoding/hex"
+    "fmt"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Resolve turns a revision such as a branch, tag, full or abbreviated SHA,
+// optionally followed by ~N, ^ or ^N suffixes, into a commit hash.
+func (r *Repo) Resolve(rev string) (Hash, error) {
+    base, suffix := rev, ""
+    if i := strings.IndexAny(rev, "~^"); i >= 0 {
+        base, suffix = rev[:i], rev[i:]
+    }
+    if base == "" {
+        base = "HEAD"
+    }
+
+    h, err := r.resolveBase(base)
+    if err != nil {
+        return ZeroHash, err
+    }
+    if h, err = r.Peel(h); err != nil {
+        return ZeroHash, err
+    }
+
+    for suffix != "" {
+        op := suffix[0]
+        suffix = suffix[1:]
+        n := 1
+        digits := 0
+        for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+            digits++
+        }
+        if digits > 0 {
+            n, _ = strconv.Atoi(suffix[:digits])
+            suffix = suffix[digits:]
+        }
+
+        if op == '^' {
+            if n == 0 {
+                continue
+            }
+            c, err := r.ReadCommit(h)
+            if err != nil {
+                return ZeroHash, err
+            }
+            if n > len(c.Parents) {
+                return ZeroHash, fmt.Errorf("%s: commit %s has no parent %d", rev, h, n)
+            }
+            h = c.Parents[n-1]
+            continue
+        }
+        for ; n > 0; n-- {
+            c, err := r.ReadCommit(h)
+            if err != nil {
+                return ZeroHash, err
+            }
+            if len(c.Parents) == 0 {
+                return ZeroHash, fmt.Errorf("%s: commit %s has no parent", rev, h)
+            }
+            h = c.Parents[0]
+        }
+    }
+    return h, nil
+}
+
+func (r *Repo) resolveBase(name string) (Hash, error) {
+    if h, err := ParseHash(name); err == nil {
+        return h, nil
+    }
+    // same lookup order as git rev-parse
+    for _, candidate := range []string{
+        name,
+        "refs/" + name,
+        "refs/tags/" + name,
+        "refs/heads/" + name,
+        "refs/remotes/" + name,
+        "refs/remotes/" + name + "/HEAD",
+    } {
+        if h, err := r.resolveRef(candidate, 0); err == nil {
+            return h, nil
+        }
+    }
+    if len(name) >= 4 && len(name) < 40 && isHex(name) {
+        return r.resolvePrefix(strings.ToLower(name))
+    }
+    return ZeroHash, fmt.Errorf("unknown revision %q", name)
+}
+
+func (r *Repo) resolvePrefix(prefix string) (Hash, error) {
+    matches := make(map[Hash]bool)
+
+    even := prefix[:len(prefix)&^1]
+    raw, _ := hex.DecodeString(even)
+    for _, p := range r.packs {
+        for _, h := range p.findPrefix(raw) {
+            if strings.HasPrefix(h.String(), prefix) {
+                matches[h] = true
+            }
+        }
+    }
+    for _, dir := range r.objectDirs {
+        entries, _ := os.ReadDir(filepath.Join(dir, prefix[:2]))
+        for _, e := range entries {
+            if !strings.HasPrefix(prefix[:2]+e.Name(), prefix) {
+                continue
+            }
+            if h, err := ParseHash(prefix[:2] + e.Name()); err == nil {
+                matches[h] = true
+            }
+        }
+    }
+
+    switch len(matches) {
+    case 0:
+        return ZeroHash, fmt.Errorf("unknown revision %q", prefix)
+    case 1:
+        for h := range matches {
+            return h, nil
+        }
+    }
+    return ZeroHash, fmt.Errorf("short object id %q is ambiguous", prefix)
+}
+
+func isHex(s string) bool {
+    for _, c := range s {
+        if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+            return false
+        }
+    }
+    return true
+}
+
+// RemoteURL returns the configured URL of the named remote, if any.
+func (r *Repo) RemoteURL(remote string) string {
+    data, err := readFileString(commonDir(r.GitDir), "config")
+    if err != nil {
+        return ""
+    }
+    section := fmt.Sprintf(`[remote "%s"]`, remote)
+    in := false
+    for _, line := range strings.Split(data, "\n") {
+        line = strings.TrimSpace(line)
+        if strings.HasPrefix(line, "[") {
+            in = line == section
+            continue
+        }
+        if !in {
+            continue
+        }
+        key, value, ok := strings.Cut(line, "=")
+        if ok && strings.TrimSpace(key) == "url" {
+            return strings.TrimSpace(value)
+        }
+    }
+    return ""
+}
@@ -0,0 +1,137 @@
+// Package glob matches slash-separated paths against doublestar patterns:
+// `*` and `?` stay within one path segment, `**` spans any number of
+// segments, `[...]` is a character class and `{a,b}` picks alternatives.
+package glob
+
+import (
+    "errors"
+    "path"
+    "strings"
+)
+
+// Match reports whether name matches pattern in full. Malformed patterns
+// never match; use Validate to reject them up front.
+func Match(pattern, name string) bool {
+    for _, p := range expandBraces(pattern) {
+        if matchSegments(strings.Split(p, "/"), strings.Split(name, "/")) {
+            return true
+        }
+    }
+    return false
+}
+
+// MatchAnySuffix reports whether pattern matches name or any trailing run
+// of its segments, so `docs/*.md` matches `/src/repo/docs/a.md` whatever
+// the scan root was.
+func MatchAnySuffix(pattern, name string) bool {
+    name = strings.TrimPrefix(name, "./")
+    for {
+        if Match(pattern, name) {
+            return true
+        }
+        i := strings.IndexByte(name, '/')
+        if i < 0 {
+            return false
+        }
+        name = name[i+1:]
+    }
+}
+
+// ErrAnchored is returned by Validate for a pattern starting with `/`.
+// Patterns are matched against relative paths or trailing parts of a
+// path, which never start with `/`, so such a pattern would never match.
+var ErrAnchored = errors.New("glob must not start with /")
+
+// Validate returns path.ErrBadPattern if pattern is malformed, or
+// ErrAnchored if it starts with `/`.
+func Validate(pattern string) error {
+    if strings.HasPrefix(pattern, "/") {
+        return ErrAnchored
+    }
+    for _, p := range expandBraces(pattern) {
+        for _, seg := range strings.Split(p, "/") {
+            if _, err := path.Match(seg, ""); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func matchSegments(pat, name []string) bool {
+    for len(pat) > 0 {
+        if pat[0] == "**" {
+            // collapse runs of ** and try every split point
+            for len(pat) > 0 && pat[0] == "**" {
+                pat = pat[1:]
+            }
+            if len(pat) == 0 {
+                return true
+            }
+            for i := range name {
+                if matchSegments(pat, name[i:]) {
+                    return true
+                }
+            }
+            return false
+        }
+        if len(name) == 0 {
+            return false
+        }
+        if ok, err := path.Match(pat[0], name[0]); err != nil || !ok {
+            return false
+        }
+        pat, name = pat[1:], name[1:]
+    }
+    return len(name) == 0
+}
+
+// expandBraces rewrites `a{b,c}d` into `abd` and `acd`, recursively. An
+// unbalanced or backslash-escaped brace is left as a literal.
+func expandBraces(pattern string) []string {
+    open := -1
+    for i := 0; i < len(pattern); i++ {
+        if pattern[i] == '\\' {
+            i++
+            continue
+        }
+        if pattern[i] == '{' {
+            open = i
+            break
+        }
+    }
+    if open < 0 {
+        return []string{pattern}
+    }
+    depth := 0
+    var alts []string
+    start := open + 1
+    for i := open; i < len(pattern); i++ {
+        switch pattern[i] {
+        case '\\':
+            i++
+        case '{':
+            depth++
+        case ',':
+            if depth == 1 {
+                alts = append(alts, pattern[start:i])
+                start = i + 1
+            }
+        case '}':
+            depth--
+            if depth == 0 {
+                alts = append(alts, pattern[start:i])
+                var out []string
+                for _, rest := range expandBraces(pattern[i+1:]) {
+                    for _, alt := range alts {
+                        for _, a := range expandBraces(alt) {
+                            out = append(out, pattern[:open]+a+rest)
+                        }
+                    }
+                }
+                return out
+            }
+        }
+    }
+    return []string{pattern}
+}
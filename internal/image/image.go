@@ -0,0 +1,329 @@
+package image
+
+import (
+    "archive/tar"
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+)
+
+const (
+    mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+    mediaTypeDockerIndex = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var errNotImage = errors.New("not an OCI image layout or docker save archive")
+
+// Layer is one filesystem layer of an image.
+type Layer struct {
+    Digest string // sha256:<hex> of the blob, or its diff ID for old docker save archives
+    name   string // where the layer lives in the layout
+}
+
+// Manifest is one image in the layout: its tags and its layers, lowest
+// first.
+type Manifest struct {
+    Tags   []string
+    Layers []Layer
+}
+
+// Image reads an OCI image layout or a `docker save` archive, either as a
+// directory or as a tarball, without a registry or a container runtime.
+type Image struct {
+    Manifests []Manifest
+    src       source
+}
+
+// source reads files of the layout by name.
+type source interface {
+    open(name string) (io.ReadCloser, error)
+    Close() error
+}
+
+// Open reads the manifests of the image at p. Layer contents are only read
+// by OpenLayer.
+func Open(p string) (*Image, error) {
+    info, err := os.Stat(p)
+    if err != nil {
+        return nil, err
+    }
+    var src source
+    if info.IsDir() {
+        src = dirSource(p)
+    } else {
+        src, err = openTarSource(p)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    img := &Image{src: src}
+    if err := img.readManifests(); err != nil {
+        src.Close()
+        return nil, err
+    }
+    return img, nil
+}
+
+func (img *Image) Close() error {
+    return img.src.Close()
+}
+
+func (img *Image) readManifests() error {
+    // docker save writes manifest.json (newer versions also an OCI
+    // index.json); it names the layers and config directly
+    if r, err := img.src.open("manifest.json"); err == nil {
+        defer r.Close()
+        return img.readDockerManifest(r)
+    }
+    r, err := img.src.open("index.json")
+    if err != nil {
+        return errNotImage
+    }
+    defer r.Close()
+    var idx ociIndex
+    if err := json.NewDecoder(r).Decode(&idx); err != nil {
+        return fmt.Errorf("index.json: %w", err)
+    }
+    return img.readIndex(idx, 0)
+}
+
+type dockerManifest struct {
+    Config   string
+    RepoTags []string
+    Layers   []string
+}
+
+type imageConfig struct {
+    RootFS struct {
+        DiffIDs []string `json:"diff_ids"`
+    } `json:"rootfs"`
+}
+
+func (img *Image) readDockerManifest(r io.Reader) error {
+    var manifests []dockerManifest
+    if err := json.NewDecoder(r).Decode(&manifests); err != nil {
+        return fmt.Errorf("manifest.json: %w", err)
+    }
+    for _, dm := range manifests {
+        var cfg imageConfig
+        if dm.Config != "" {
+            if err := img.readJSON(dm.Config, &cfg); err != nil {
+                return err
+            }
+        }
+        m := Manifest{Tags: dm.RepoTags}
+        for i, name := range dm.Layers {
+            l := Layer{name: name, Digest: blobDigest(name)}
+            if l.Digest == "" && i < len(cfg.RootFS.DiffIDs) {
+                l.Digest = cfg.RootFS.DiffIDs[i]
+            }
+            if l.Digest == "" {
+                // legacy id/layer.tar names carry no digest; hash it
+                d, err := img.hashFile(name)
+                if err != nil {
+                    return err
+                }
+                l.Digest = d
+            }
+            m.Layers = append(m.Layers, l)
+        }
+        img.Manifests = append(img.Manifests, m)
+    }
+    return nil
+}
+
+type descriptor struct {
+    MediaType   string            `json:"mediaType"`
+    Digest      string            `json:"digest"`
+    Annotations map[string]string `json:"annotations"`
+}
+
+type ociIndex struct {
+    MediaType string       `json:"mediaType"`
+    Manifests []descriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+    MediaType string       `json:"mediaType"`
+    Manifests []descriptor `json:"manifests"` // set when this is an index
+    Layers    []descriptor `json:"layers"`
+}
+
+// maxIndexDepth bounds index-of-index nesting in a layout.
+const maxIndexDepth = 4
+
+func (img *Image) readIndex(idx ociIndex, depth int) error {
+    if depth > maxIndexDepth {
+        return errors.New("image index nested too deeply")
+    }
+    for _, d := range idx.Manifests {
+        var om ociManifest
+        if err := img.readJSON(blobPath(d.Digest), &om); err != nil {
+            return err
+        }
+        if d.MediaType == mediaTypeOCIIndex || d.MediaType == mediaTypeDockerIndex || len(om.Manifests) > 0 {
+            if err := img.readIndex(ociIndex{Manifests: om.Manifests}, depth+1); err != nil {
+                return err
+            }
+            continue
+        }
+        m := Manifest{}
+        if tag := d.Annotations["org.opencontainers.image.ref.name"]; tag != "" {
+            m.Tags = []string{tag}
+        }
+        for _, l := range om.Layers {
+            m.Layers = append(m.Layers, Layer{Digest: l.Digest, name: blobPath(l.Digest)})
+        }
+        img.Manifests = append(img.Manifests, m)
+    }
+    return nil
+}
+
+func (img *Image) readJSON(name string, v any) error {
+    r, err := img.src.open(name)
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+    if err := json.NewDecoder(r).Decode(v); err != nil {
+        return fmt.Errorf("%s: %w", name, err)
+    }
+    return nil
+}
+
+func (img *Image) hashFile(name string) (string, error) {
+    r, err := img.src.open(name)
+    if err != nil {
+        return "", err
+    }
+    defer r.Close()
+    h := sha256.New()
+    if _, err := io.Copy(h, r); err != nil {
+        return "", err
+    }
+    return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// blobPath is where a layout keeps the blob with digest d.
+func blobPath(d string) string {
+    alg, hexDigest, _ := strings.Cut(d, ":")
+    return path.Join("blobs", alg, hexDigest)
+}
+
+// blobDigest is the inverse of blobPath, or "" if name is not a blob.
+func blobDigest(name string) string {
+    parts := strings.Split(path.Clean(name), "/")
+    if len(parts) != 3 || parts[0] != "blobs" {
+        return ""
+    }
+    return parts[1] + ":" + parts[2]
+}
+
+// OpenLayer returns the layer's tar stream, decompressed.
+func (img *Image) OpenLayer(l Layer) (*tar.Reader, io.Closer, error) {
+    r, err := img.src.open(l.name)
+    if err != nil {
+        return nil, nil, err
+    }
+    br := bufio.NewReader(r)
+    magic, _ := br.Peek(4)
+    switch {
+    case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+        zr, err := gzip.NewReader(br)
+        if err != nil {
+            r.Close()
+            return nil, nil, fmt.Errorf("layer %s: %w", l.Digest, err)
+        }
+        return tar.NewReader(zr), r, nil
+    case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+        r.Close()
+        return nil, nil, fmt.Errorf("layer %s: zstd compression is not supported", l.Digest)
+    }
+    return tar.NewReader(br), r, nil
+}
+
+// Whiteout reports whether name, a path inside a layer, is an AUFS/OCI
+// whiteout. For a plain whiteout target is the path it deletes; for an
+// opaque one it is the directory whose earlier contents are hidden.
+func Whiteout(name string) (target string, opaque, ok bool) {
+    dir, base := path.Split(name)
+    dir = strings.TrimSuffix(dir, "/")
+    switch {
+    case base == ".wh..wh..opq":
+        return dir, true, true
+    case strings.HasPrefix(base, ".wh."):
+        return path.Join(dir, strings.TrimPrefix(base, ".wh.")), false, true
+    }
+    return "", false, false
+}
+
+type dirSource string
+
+func (d dirSource) open(name string) (io.ReadCloser, error) {
+    return os.Open(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+func (d dirSource) Close() error { return nil }
+
+// tarSource reads a layout packed in a tarball. Entries are indexed once
+// and read in place, so layers are never copied out.
+type tarSource struct {
+    f       *os.File
+    entries map[string]tarEntry
+}
+
+type tarEntry struct {
+    offset, size int64
+}
+
+func openTarSource(p string) (*tarSource, error) {
+    f, err := os.Open(p)
+    if err != nil {
+        return nil, err
+    }
+    ts := &tarSource{f: f, entries: make(map[string]tarEntry)}
+    tr := tar.NewReader(f)
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return ts, nil
+        }
+        if err != nil {
+            f.Close()
+            return nil, fmt.Errorf("%s: %w", p, err)
+        }
+        if hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+        // tar.Reader stops at the start of the entry's data
+        off, err := f.Seek(0, io.SeekCurrent)
+        if err != nil {
+            f.Close()
+            return nil, err
+        }
+        ts.entries[path.Clean(hdr.Name)] = tarEntry{offset: off, size: hdr.Size}
+    }
+}
+
+func (ts *tarSource) open(name string) (io.ReadCloser, error) {
+    e, ok := ts.entries[path.Clean(name)]
+    if !ok {
+        return nil, fmt.Errorf("%s: %w", name, os.ErrNotExist)
+    }
+    return io.NopCloser(io.NewSectionReader(ts.f, e.offset, e.size)), nil
+}
+
+func (ts *tarSource) Close() error {
+    return ts.f.Close()
+}
@@ -0,0 +1,80 @@
+package report
+
+import (
+    "strings"
+    "unicode/utf8"
+
+    "superscan/internal/scanner"
+)
+
+// RedactSecret masks the middle of a secret, keeping up to four characters
+// at each end (a quarter of the value at most) so it can still be
+// recognised. Very short values are masked entirely.
+func RedactSecret(s string) string {
+    runes := []rune(s)
+    keep := len(runes) / 4
+    if keep > 4 {
+        keep = 4
+    }
+    masked := make([]rune, len(runes))
+    for i, r := range runes {
+        switch {
+        case r == '\n' || r == '\r':
+            masked[i] = r
+        case i < keep || i >= len(runes)-keep:
+            masked[i] = r
+        default:
+            masked[i] = '*'
+        }
+    }
+    return string(masked)
+}
+
+// Redact returns copies of findings with Match and Encoded, and every
+// occurrence of them in Snippet, masked, in Related findings too.
+// Fingerprints must already be set, since they are derived from the raw
+// value.
+func Redact(findings []scanner.Finding) []scanner.Finding {
+    out := make([]scanner.Finding, len(findings))
+    for i, f := range findings {
+        if f.Match != "" {
+            for _, part := range strings.Split(f.Match, "\n") {
+                part = strings.TrimSpace(part)
+                if part != "" {
+                    f.Snippet = redactIn(f.Snippet, part)
+                }
+            }
+            if f.FullMatch != "" {
+                f.FullMatch = redactIn(f.FullMatch, f.Match)
+            }
+            f.Match = RedactSecret(f.Match)
+        }
+        if f.Encoded != "" {
+            f.Snippet = redactIn(f.Snippet, f.Encoded)
+            f.Encoded = RedactSecret(f.Encoded)
+        }
+        if len(f.Related) > 0 {
+            f.Related = Redact(f.Related)
+        }
+        out[i] = f
+    }
+    return out
+}
+
+func redactIn(s, secret string) string {
+    if strings.Contains(s, secret) {
+        return strings.ReplaceAll(s, secret, RedactSecret(secret))
+    }
+    // the snippet was cut off partway through the secret
+    if body, ok := strings.CutSuffix(s, "..."); ok {
+        for n := len(secret) - 1; n >= 4; n-- {
+            if !utf8.RuneStart(secret[n]) {
+                continue
+            }
+            if strings.HasSuffix(body, secret[:n]) {
+                return body[:len(body)-n] + RedactSecret(secret[:n]) + "..."
+            }
+        }
+    }
+    return s
+}
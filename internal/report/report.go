@@ -2,15 +2,18 @@ package report
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"superscan/internal/scanner"
 )
 
 type JSONReport struct {
-	RootPath string            `json:"root_path"`
-	Duration string            `json:"duration"`
-	Findings []scanner.Finding `json:"findings"`
+	RootPath   string            `json:"root_path"`
+	Duration   string            `json:"duration"`
+	Findings   []scanner.Finding `json:"findings"`
+	Suppressed []scanner.Finding `json:"suppressed,omitempty"`
+	Skipped    []scanner.Finding `json:"skipped,omitempty"`
 }
 
 // SARIF Structures
@@ -21,8 +24,15 @@ type SarifReport struct {
 }
 
 type Run struct {
-	Tool    Tool     `json:"tool"`
-	Results []Result `json:"results"`
+	Tool                     Tool                    `json:"tool"`
+	Results                  []Result                `json:"results"`
+	ColumnKind               string                  `json:"columnKind,omitempty"`
+	VersionControlProvenance []VersionControlDetails `json:"versionControlProvenance,omitempty"`
+}
+
+type VersionControlDetails struct {
+	RepositoryUri string `json:"repositoryUri"`
+	RevisionId    string `json:"revisionId,omitempty"`
 }
 
 type Tool struct {
@@ -52,11 +62,28 @@ type Properties struct {
 }
 
 type Result struct {
-	RuleID      string      `json:"ruleId"`
-	Level       string      `json:"level"` // error, warning, note
-	Message     Message     `json:"message"`
-	Locations   []Location  `json:"locations"`
-	Fingerprints Fingerprints `json:"fingerprints"`
+	RuleID           string            `json:"ruleId"`
+	Level            string            `json:"level"` // error, warning, note
+	Message          Message           `json:"message"`
+	Locations        []Location        `json:"locations"`
+	RelatedLocations []Location        `json:"relatedLocations,omitempty"`
+	Fingerprints     Fingerprints      `json:"fingerprints"`
+	Properties       *ResultProperties `json:"properties,omitempty"`
+	Suppressions     []Suppression     `json:"suppressions,omitempty"`
+}
+
+type Suppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type ResultProperties struct {
+	CommitSha    string `json:"commitSha,omitempty"`
+	Author       string `json:"author,omitempty"`
+	Date         string `json:"date,omitempty"`
+	Verification string `json:"verification,omitempty"`
+	Layer        string `json:"layer,omitempty"`
+	RemovedIn    string `json:"removedIn,omitempty"`
 }
 
 type Message struct {
@@ -77,8 +104,12 @@ type ArtifactLocation struct {
 }
 
 type Region struct {
-	StartLine   int `json:"startLine"`
-	StartColumn int `json:"startColumn,omitempty"`
+	StartLine   int  `json:"startLine"`
+	StartColumn int  `json:"startColumn,omitempty"`
+	EndLine     int  `json:"endLine,omitempty"`
+	EndColumn   int  `json:"endColumn,omitempty"`
+	ByteOffset  *int `json:"byteOffset,omitempty"`
+	ByteLength  int  `json:"byteLength,omitempty"`
 }
 
 type Fingerprints struct {
@@ -118,7 +149,7 @@ func GenerateSARIF(findings []scanner.Finding) SarifReport {
 			RuleID: f.RuleID,
 			Level:  level,
 			Message: Message{
-				Text: fmt.Sprintf("Found potential secret: %s", f.Description),
+				Text: message(f),
 			},
 			Locations: []Location{
 				{
@@ -126,15 +157,16 @@ func GenerateSARIF(findings []scanner.Finding) SarifReport {
 						ArtifactLocation: ArtifactLocation{
 							Uri: f.File,
 						},
-						Region: Region{
-							StartLine: f.Line,
-						},
+						Region: region(f),
 					},
 				},
 			},
             Fingerprints: Fingerprints{
                 MatchSha1: f.Fingerprint,
             },
+			RelatedLocations: relatedLocations(f),
+			Properties:       resultProperties(f),
+			Suppressions:     suppressions(f),
 		})
 	}
 
@@ -151,16 +183,93 @@ func GenerateSARIF(findings []scanner.Finding) SarifReport {
 						Rules:           sarifRules,
 					},
 				},
-				Results: results,
+				Results:    results,
+				ColumnKind: "unicodeCodePoints",
 			},
 		},
 	}
 }
 
-func PrintTextReport(root string, duration time.Duration, findings []scanner.Finding) {
+func message(f scanner.Finding) string {
+	switch {
+	case f.Resource != "" && f.KeyPath != "":
+		return fmt.Sprintf("Found potential secret: %s (%s, key %s)", f.Description, f.Resource, f.KeyPath)
+	case f.Resource != "":
+		return fmt.Sprintf("Found potential secret: %s (%s)", f.Description, f.Resource)
+	case f.KeyPath != "":
+		return fmt.Sprintf("Found potential secret: %s (key %s)", f.Description, f.KeyPath)
+	case f.Notebook != nil:
+		return fmt.Sprintf("Found potential secret: %s (cell %d, %s line %d)", f.Description, f.Notebook.Index, f.Notebook.Type, f.Notebook.Line)
+	}
+	return fmt.Sprintf("Found potential secret: %s", f.Description)
+}
+
+func region(f scanner.Finding) Region {
+	r := Region{
+		StartLine:   f.Line,
+		StartColumn: f.StartColumn,
+		EndLine:     f.EndLine,
+		EndColumn:   f.EndColumn,
+	}
+	if f.EndOffset > 0 {
+		offset := f.StartOffset
+		r.ByteOffset = &offset
+		r.ByteLength = f.EndOffset - f.StartOffset
+	}
+	return r
+}
+
+// relatedLocations points at the findings a composite finding groups.
+func relatedLocations(f scanner.Finding) []Location {
+	var out []Location
+	for _, r := range f.Related {
+		out = append(out, Location{
+			PhysicalLocation: PhysicalLocation{
+				ArtifactLocation: ArtifactLocation{Uri: r.File},
+				Region:           region(r),
+			},
+		})
+	}
+	return out
+}
+
+func suppressions(f scanner.Finding) []Suppression {
+	if !f.Suppressed {
+		return nil
+	}
+	return []Suppression{{Kind: "inSource", Justification: f.SuppressionReason}}
+}
+
+func resultProperties(f scanner.Finding) *ResultProperties {
+	if f.Commit == "" && f.Verification == "" && f.Layer == "" {
+		return nil
+	}
+	return &ResultProperties{
+		CommitSha:    f.Commit,
+		Author:       f.Author,
+		Date:         f.Date,
+		Verification: f.Verification,
+		Layer:        f.Layer,
+		RemovedIn:    f.RemovedIn,
+	}
+}
+
+func PrintTextReport(root string, duration time.Duration, findings, skipped []scanner.Finding) {
     fmt.Printf("Scan root: %s\n", root)
     fmt.Printf("Duration : %s\n", duration)
-    fmt.Printf("Findings : %d\n\n", len(findings))
+    fmt.Printf("Findings : %d\n", len(findings))
+    if len(skipped) > 0 {
+        fmt.Printf("Skipped  : %d files\n", len(skipped))
+    }
+    fmt.Println()
+
+    // binary files are expected to be skipped; anything else may hide a
+    // secret and is listed
+    for _, f := range skipped {
+        if f.RuleID != "skipped_binary" {
+            fmt.Printf("[skipped] %s\n  %s\n\n", f.File, f.Description)
+        }
+    }
 
     if len(findings) == 0 {
         fmt.Println("No potential secrets found.")
@@ -172,16 +281,55 @@ func PrintTextReport(root string, duration time.Duration, findings []scanner.Fin
         if f.Line > 0 {
             loc = fmt.Sprintf("%s:%d", f.File, f.Line)
         }
+        if f.StartColumn > 0 {
+            loc = fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.StartColumn)
+        }
+        if f.EndLine > f.Line {
+            loc = fmt.Sprintf("%s:%d:%d-%d:%d", f.File, f.Line, f.StartColumn, f.EndLine, f.EndColumn)
+        }
         fmt.Printf("[%s] %s\n", f.Type, loc)
+        if f.Commit != "" {
+            fmt.Printf("  Commit   : %s\n", f.Commit)
+            fmt.Printf("  Author   : %s <%s>\n", f.Author, f.Email)
+            fmt.Printf("  Date     : %s\n", f.Date)
+        }
+        if f.Layer != "" {
+            fmt.Printf("  Layer    : %s\n", f.Layer)
+        }
+        if f.RemovedIn != "" {
+            fmt.Printf("  Removed  : in layer %s (still in the image history)\n", f.RemovedIn)
+        }
+        if f.Resource != "" {
+            fmt.Printf("  Resource : %s\n", f.Resource)
+        }
+        if f.KeyPath != "" {
+            fmt.Printf("  Key      : %s\n", f.KeyPath)
+        }
+        if f.Notebook != nil {
+            fmt.Printf("  Cell     : %s\n", f.Notebook)
+        }
         fmt.Printf("  Rule     : %s\n", f.RuleID)
         fmt.Printf("  Severity : %s\n", f.Severity)
         fmt.Printf("  Desc     : %s\n", f.Description)
         if len(f.Tags) > 0 {
             fmt.Printf("  Tags     : %v\n", f.Tags)
         }
-        if f.Match != "" {
+        if len(f.Related) > 0 {
+            for _, r := range f.Related {
+                fmt.Printf("  Part     : %s at line %d: %s\n", r.RuleID, r.Line, r.Match)
+            }
+        } else if f.Match != "" {
             fmt.Printf("  Match    : %s\n", f.Match)
         }
+        if len(f.Decoding) > 0 {
+            fmt.Printf("  Decoded  : %s from %s\n", strings.Join(f.Decoding, " -> "), f.Encoded)
+        }
+        if f.Suppressed {
+            fmt.Printf("  Ignored  : %s\n", f.SuppressionReason)
+        }
+        if f.Verification != "" {
+            fmt.Printf("  Verified : %s\n", f.Verification)
+        }
         if f.Entropy > 0 {
             fmt.Printf("  Entropy  : %.2f\n", f.Entropy)
         }
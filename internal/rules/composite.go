@@ -0,0 +1,94 @@
+package rules
+
+import (
+    "fmt"
+    "strings"
+)
+
+// CompositeRuleConfig groups other rules: it fires when every rule in
+// Rules has a finding in the same file, or with WithinLines set, within
+// that many lines of each other.
+type CompositeRuleConfig struct {
+    ID          string   `yaml:"id"`
+    Description string   `yaml:"description"`
+    Rules       []string `yaml:"rules"`
+    WithinLines int      `yaml:"within_lines"` // 0 means anywhere in the file
+    Severity    string   `yaml:"severity"`     // default: one above the most severe part
+    Tags        []string `yaml:"tags"`
+}
+
+type CompositeRule struct {
+    ID          string
+    Description string
+    Rules       []string
+    WithinLines int
+    Severity    string
+    Tags        []string
+}
+
+var severityLevels = []string{"low", "medium", "high", "critical"}
+
+// CombinedSeverity is the severity of a composite finding built from
+// parts with the given severities: the rule's own if set, else one level
+// above the most severe part.
+func (c CompositeRule) CombinedSeverity(parts []string) string {
+    if c.Severity != "" {
+        return c.Severity
+    }
+    top := -1
+    for _, s := range parts {
+        for i, level := range severityLevels {
+            if strings.EqualFold(s, level) && i > top {
+                top = i
+            }
+        }
+    }
+    if top+1 >= len(severityLevels) {
+        return "critical"
+    }
+    if top < 0 {
+        return "medium"
+    }
+    return severityLevels[top+1]
+}
+
+// AddCompositeRules adds composite rules to rs. They may only refer to
+// rules already in it, or to sensitive_filename.
+func (rs *RuleSet) AddCompositeRules(cfgs []CompositeRuleConfig) error {
+    known := map[string]bool{"sensitive_filename": true}
+    for _, r := range rs.PatternRules {
+        known[r.ID] = true
+    }
+    for _, r := range rs.EntropyRules {
+        known[r.ID] = true
+    }
+    for _, c := range rs.CompositeRules {
+        known[c.ID] = true
+    }
+
+    for _, cfg := range cfgs {
+        if cfg.ID == "" || len(cfg.Rules) < 2 {
+            return fmt.Errorf("composite rule %q needs an id and at least two rules", cfg.ID)
+        }
+        if known[cfg.ID] {
+            return fmt.Errorf("composite rule %s: id already used by another rule", cfg.ID)
+        }
+        if cfg.WithinLines < 0 {
+            return fmt.Errorf("composite rule %s: within_lines must not be negative", cfg.ID)
+        }
+        for _, id := range cfg.Rules {
+            if !known[id] {
+                return fmt.Errorf("composite rule %s: unknown rule %q", cfg.ID, id)
+            }
+        }
+        rs.CompositeRules = append(rs.CompositeRules, CompositeRule{
+            ID:          cfg.ID,
+            Description: cfg.Description,
+            Rules:       cfg.Rules,
+            WithinLines: cfg.WithinLines,
+            Severity:    cfg.Severity,
+            Tags:        cfg.Tags,
+        })
+    }
+    return nil
+}
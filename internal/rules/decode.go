@@ -0,0 +1,140 @@
+package rules
+
+import (
+    "encoding/base64"
+    "encoding/hex"
+    "net/url"
+    "regexp"
+    "strings"
+    "unicode/utf8"
+)
+
+const (
+    // minEncodedLen keeps short identifiers from being decoded as base64
+    // or hex; it is 12 bytes of payload either way.
+    minEncodedLen = 16
+    // maxDecodes caps the tokens decoded per line over all depths, so a
+    // line of nested encodings costs a bounded amount of work.
+    maxDecodes = 32
+)
+
+var (
+    base64TokenRe = regexp.MustCompile(`[A-Za-z0-9+/_-]{16,}={0,2}`)
+    urlTokenRe    = regexp.MustCompile(`[^\s'"<>]*%[0-9A-Fa-f]{2}[^\s'"<>]*`)
+)
+
+// encodedToken is a span of text that may hold an encoded secret.
+type encodedToken struct {
+    start, end int
+}
+
+func encodedTokens(text string) []encodedToken {
+    var out []encodedToken
+    for _, loc := range base64TokenRe.FindAllStringIndex(text, -1) {
+        out = append(out, encodedToken{loc[0], loc[1]})
+    }
+    if strings.Contains(text, "%") {
+        for _, loc := range urlTokenRe.FindAllStringIndex(text, -1) {
+            out = append(out, encodedToken{loc[0], loc[1]})
+        }
+    }
+    return out
+}
+
+// decodeToken decodes s as hex, base64 (standard or URL-safe, padded or
+// not) or URL encoding. Only results that are printable text count: most
+// base64-looking identifiers decode to binary noise.
+func decodeToken(s string) (decoded, kind string, ok bool) {
+    if strings.Contains(s, "%") {
+        d, err := url.QueryUnescape(s)
+        if err == nil && d != s && printable(d) {
+            return d, "url", true
+        }
+        return "", "", false
+    }
+    if len(s) < minEncodedLen {
+        return "", "", false
+    }
+    if len(s)%2 == 0 {
+        if b, err := hex.DecodeString(s); err == nil && printable(string(b)) {
+            return string(b), "hex", true
+        }
+    }
+    trimmed := strings.TrimRight(s, "=")
+    if len(trimmed)%4 == 1 {
+        return "", "", false
+    }
+    enc := base64.RawStdEncoding
+    if strings.ContainsAny(trimmed, "-_") {
+        if strings.ContainsAny(trimmed, "+/") {
+            return "", "", false
+        }
+        enc = base64.RawURLEncoding
+    }
+    b, err := enc.DecodeString(trimmed)
+    if err != nil || !printable(string(b)) {
+        return "", "", false
+    }
+    return string(b), "base64", true
+}
+
+func printable(s string) bool {
+    if len(s) < 8 || !utf8.ValidString(s) {
+        return false
+    }
+    for _, r := range s {
+        if (r < 0x20 && r != '\n' && r != '\r' && r != '\t') || r == 0x7f || r == utf8.RuneError {
+            return false
+        }
+    }
+    return true
+}
+
+// MatchDecoded finds base64, hex and URL-encoded tokens in line, decodes
+// them, and runs the pattern rules on the decoded text, following nested
+// encodings up to MaxDecodeDepth levels. Start and End give the encoded
+// token in line, Match the decoded secret and Decoding the chain of
+// encodings peeled off, outermost first.
+func (rs *RuleSet) MatchDecoded(line string) []PatternMatch {
+    if rs.MaxDecodeDepth <= 0 {
+        return nil
+    }
+    budget := maxDecodes
+    out := rs.matchDecoded(line, nil, 1, &budget)
+    for i := range out {
+        out[i].Encoded = line[out[i].Start:out[i].End]
+    }
+    return out
+}
+
+func (rs *RuleSet) matchDecoded(text string, chain []string, depth int, budget *int) []PatternMatch {
+    var out []PatternMatch
+    for _, t := range encodedTokens(text) {
+        if *budget <= 0 {
+            break
+        }
+        decoded, kind, ok := decodeToken(text[t.start:t.end])
+        if !ok {
+            continue
+        }
+        *budget--
+        c := append(chain[:len(chain):len(chain)], kind)
+
+        found := append(rs.MatchPatterns(decoded), rs.MatchMultiline(decoded)...)
+        for i := range found {
+            found[i].Decoding = c
+        }
+        if depth < rs.MaxDecodeDepth {
+            found = append(found, rs.matchDecoded(decoded, c, depth+1, budget)...)
+        }
+        for _, m := range found {
+            // the plain scan already reports secrets that appear as is
+            if strings.Contains(text, m.Match) {
+                continue
+            }
+            m.Start, m.End = t.start, t.end
+            out = append(out, m)
+        }
+    }
+    return out
+}
@@ -0,0 +1,189 @@
+package rules
+
+import (
+    "regexp/syntax"
+    "strings"
+    "unicode/utf8"
+)
+
+// deriveKeywords returns literals of which every match of expr contains at
+// least one, or nil when no such set can be read off the regex. Keywords
+// are compared case-insensitively, so (?i) literals are usable too.
+func deriveKeywords(expr string) []string {
+    re, err := syntax.Parse(expr, syntax.Perl)
+    if err != nil {
+        return nil
+    }
+    return requiredLiterals(re.Simplify())
+}
+
+func requiredLiterals(re *syntax.Regexp) []string {
+    switch re.Op {
+    case syntax.OpLiteral:
+        s := string(re.Rune)
+        if re.Flags&syntax.FoldCase != 0 && (!isASCII(s) || strings.ContainsAny(s, "kKsS")) {
+            // ASCII lowercasing can't fold these, and (?i) k and s also
+            // match the Kelvin sign and long s; give up rather than miss
+            return nil
+        }
+        return []string{s}
+    case syntax.OpCapture, syntax.OpPlus:
+        return requiredLiterals(re.Sub[0])
+    case syntax.OpRepeat:
+        if re.Min == 0 {
+            return nil
+        }
+        return requiredLiterals(re.Sub[0])
+    case syntax.OpConcat:
+        // the most selective child: the one whose shortest literal is longest
+        var best []string
+        bestLen := 0
+        for _, sub := range re.Sub {
+            lits := requiredLiterals(sub)
+            if n := shortest(lits); n > bestLen {
+                best, bestLen = lits, n
+            }
+        }
+        return best
+    case syntax.OpAlternate:
+        var out []string
+        for _, sub := range re.Sub {
+            lits := requiredLiterals(sub)
+            if lits == nil {
+                return nil
+            }
+            out = append(out, lits...)
+        }
+        return out
+    }
+    return nil
+}
+
+func shortest(lits []string) int {
+    if len(lits) == 0 {
+        return 0
+    }
+    n := len(lits[0])
+    for _, l := range lits[1:] {
+        if len(l) < n {
+            n = len(l)
+        }
+    }
+    return n
+}
+
+func isASCII(s string) bool {
+    for i := 0; i < len(s); i++ {
+        if s[i] >= utf8.RuneSelf {
+            return false
+        }
+    }
+    return true
+}
+
+func lowerASCII(c byte) byte {
+    if 'A' <= c && c <= 'Z' {
+        return c + 'a' - 'A'
+    }
+    return c
+}
+
+// keywordMatcher is an Aho-Corasick automaton over rule keywords. One pass
+// over a line finds every rule whose keywords occur in it. The trie is
+// compiled into a dense transition table over byte classes, so matching is
+// one table lookup per input byte.
+type keywordMatcher struct {
+    trie    []map[byte]int
+    class   [256]uint8 // byte -> class; 0 is every byte no keyword uses
+    classes int
+    delta   []int32 // state*classes + class -> next state
+    rules   [][]int // rule indices whose keyword ends in this state
+}
+
+func newKeywordMatcher() *keywordMatcher {
+    return &keywordMatcher{
+        trie:  []map[byte]int{{}},
+        rules: [][]int{nil},
+    }
+}
+
+func (m *keywordMatcher) add(keyword string, rule int) {
+    s := 0
+    for i := 0; i < len(keyword); i++ {
+        c := lowerASCII(keyword[i])
+        t, ok := m.trie[s][c]
+        if !ok {
+            t = len(m.trie)
+            m.trie = append(m.trie, map[byte]int{})
+            m.rules = append(m.rules, nil)
+            m.trie[s][c] = t
+        }
+        s = t
+    }
+    m.rules[s] = append(m.rules[s], rule)
+}
+
+// build computes failure links breadth-first and turns them into the
+// transition table. Each state also inherits the outputs of its failure
+// state, so matching needs no chain walk.
+func (m *keywordMatcher) build() {
+    m.classes = 1
+    for _, edges := range m.trie {
+        for c := range edges {
+            if m.class[c] == 0 {
+                m.class[c] = uint8(m.classes)
+                m.classes++
+                // keywords are lowercased; input is folded through the class table
+                if 'a' <= c && c <= 'z' {
+                    m.class[c-'a'+'A'] = m.class[c]
+                }
+            }
+        }
+    }
+
+    n := len(m.trie)
+    fail := make([]int, n)
+    m.delta = make([]int32, n*m.classes)
+    for c, t := range m.trie[0] {
+        m.delta[int(m.class[c])] = int32(t)
+    }
+    queue := make([]int, 0, n)
+    for _, t := range m.trie[0] {
+        queue = append(queue, t)
+    }
+    for len(queue) > 0 {
+        s := queue[0]
+        queue = queue[1:]
+        m.rules[s] = append(m.rules[s], m.rules[fail[s]]...)
+        for k := 0; k < m.classes; k++ {
+            m.delta[s*m.classes+k] = m.delta[fail[s]*m.classes+k]
+        }
+        for c, t := range m.trie[s] {
+            fail[t] = int(m.delta[fail[s]*m.classes+int(m.class[c])])
+            m.delta[s*m.classes+int(m.class[c])] = int32(t)
+            queue = append(queue, t)
+        }
+    }
+    m.trie = nil
+}
+
+// match sets hits[i] for every rule i with a keyword in text.
+func (m *keywordMatcher) match(text string, hits []bool) {
+    s := 0
+    for i := 0; i < len(text); i++ {
+        s = int(m.delta[s*m.classes+int(m.class[text[i]])])
+        for _, r := range m.rules[s] {
+            hits[r] = true
+        }
+    }
+}
+
+func normalizeKeywords(kws []string) []string {
+    var out []string
+    for _, k := range kws {
+        if k = strings.TrimSpace(k); k != "" {
+            out = append(out, k)
+        }
+    }
+    return out
+}
@@ -0,0 +1,115 @@
+package rules
+
+import (
+    "fmt"
+    "os"
+    "reflect"
+    "testing"
+
+    "gopkg.in/yaml.v3"
+)
+
+// benchLines is ordinary source code with a secret every few hundred
+// lines, which is what the prefilter is tuned for.
+func benchLines() []string {
+    var lines []string
+    for i := 0; i < 1000; i++ {
+        switch {
+        case i%250 == 0:
+            lines = append(lines, fmt.Sprintf(`stripe.Key = "sk_live_%024d"`, i))
+        case i%250 == 125:
+            lines = append(lines, fmt.Sprintf(`const token = "ghp_%036d"`, i))
+        default:
+            lines = append(lines, fmt.Sprintf(`    result%d := process(ctx, items[%d], opts) // handle item %d`, i, i, i))
+        }
+    }
+    return lines
+}
+
+// shippedPatterns returns the pattern rules of the config.yml at the repo
+// root.
+func shippedPatterns(tb testing.TB) []PatternRuleConfig {
+    tb.Helper()
+    raw, err := os.ReadFile("../../config.yml")
+    if err != nil {
+        tb.Fatal(err)
+    }
+    var cfg struct {
+        Patterns []PatternRuleConfig `yaml:"patterns"`
+    }
+    if err := yaml.Unmarshal(raw, &cfg); err != nil {
+        tb.Fatal(err)
+    }
+    return cfg.Patterns
+}
+
+func TestPrefilterMatchesNoPrefilter(t *testing.T) {
+    cfgs := append(shippedPatterns(t), PatternRuleConfig{
+        ID:          "secret_key_assignment",
+        Regex:       `(?i)secret_key\s*=\s*(\w+)`,
+        SecretGroup: "1",
+        Severity:    "high",
+    })
+    rs, err := NewRuleSet(nil, cfgs, nil, AllowlistConfig{})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // (?i) matches k and s against the Kelvin sign (U+212A) and long s
+    // (U+017F) too, which ASCII keyword folding does not
+    unicodeLines := []string{
+        "\u017fecret_Key = abcd1234",
+        "SECRET_\u212aEY = abcd1234",
+        "aws_\u017fecret_access_\u212aey = \"wJalrXUtnFEMIK7MDENGbPxRfiCYzQ8a3Lk9TmRv\"",
+        "HERO\u212aU_API_KEY = \"01234567-89ab-cdef-0123-456789abcdef\"",
+    }
+    lines := append(benchLines(), unicodeLines...)
+    lines = append(lines,
+        "secret_key = abcd1234",
+        `aws_secret_access_key = "wJalrXUtnFEMIK7MDENGbPxRfiCYzQ8a3Lk9TmRv"`,
+    )
+
+    for _, line := range lines {
+        rs.NoPrefilter = true
+        want := rs.MatchPatterns(line)
+        rs.NoPrefilter = false
+        got := rs.MatchPatterns(line)
+        if !reflect.DeepEqual(got, want) {
+            t.Errorf("%q: prefilter found %d matches, without it %d", line, len(got), len(want))
+        }
+    }
+    for _, line := range unicodeLines {
+        if len(rs.MatchPatterns(line)) == 0 {
+            t.Errorf("%q: no match; the line is not exercising case folding", line)
+        }
+    }
+}
+
+// BenchmarkMatchPatterns compares the keyword prefilter against running
+// every rule of the shipped config on every line.
+func BenchmarkMatchPatterns(b *testing.B) {
+    rs, err := NewRuleSet(nil, shippedPatterns(b), nil, AllowlistConfig{})
+    if err != nil {
+        b.Fatal(err)
+    }
+    lines := benchLines()
+
+    for _, noPrefilter := range []bool{false, true} {
+        name := "prefilter"
+        if noPrefilter {
+            name = "no_prefilter"
+        }
+        b.Run(name, func(b *testing.B) {
+            rs.NoPrefilter = noPrefilter
+            found := 0
+            for i := 0; i < b.N; i++ {
+                for _, line := range lines {
+                    found += len(rs.MatchPatterns(line))
+                }
+            }
+            if found == 0 {
+                b.Fatal("no matches; the benchmark input is not exercising the rules")
+            }
+        })
+    }
+}
@@ -2,9 +2,14 @@ package rules
 
 import (
     "errors"
+    "fmt"
     "math"
+    "path/filepath"
     "regexp"
+    "strconv"
     "strings"
+
+    "superscan/internal/glob"
 )
 
 type PatternRuleConfig struct {
@@ -13,6 +18,14 @@ type PatternRuleConfig struct {
     Regex       string   `yaml:"regex"`
     Severity    string   `yaml:"severity"`
     Tags        []string `yaml:"tags"`
+    Multiline   bool     `yaml:"multiline"`
+    KeyRegex    string   `yaml:"key_regex"` // match values of structured-file keys named like this
+    Keywords    []string `yaml:"keywords"`  // derived from the regex when empty
+    AllowValues []string `yaml:"allow_values"`
+    Validator   string   `yaml:"validator"`  // post-match check, see validatorFor
+    OnInvalid   string   `yaml:"on_invalid"` // drop (default) or downgrade
+    SecretGroup string   `yaml:"secret_group"` // capture group, by index or name, holding the secret
+    PathFilterConfig `yaml:",inline"`
 }
 
 type EntropyRuleConfig struct {
@@ -22,6 +35,24 @@ type EntropyRuleConfig struct {
     EntropyThreshold float64  `yaml:"entropy_threshold"`
     Severity         string   `yaml:"severity"`
     Tags             []string `yaml:"tags"`
+    AllowValues      []string `yaml:"allow_values"`
+    PathFilterConfig `yaml:",inline"`
+}
+
+// PathFilterConfig limits a rule to some files. Globs use doublestar
+// syntax and match the file path or any trailing part of it; an empty
+// include list means every file.
+type PathFilterConfig struct {
+    IncludePaths []string `yaml:"include_paths"`
+    ExcludePaths []string `yaml:"exclude_paths"`
+}
+
+// AllowlistConfig is the global allowlist: files matching Paths are not
+// scanned by any rule, and matches of any rule against AllowValues are
+// dropped.
+type AllowlistConfig struct {
+    Paths       []string `yaml:"paths"`
+    AllowValues []string `yaml:"allow_values"`
 }
 
 type PatternRule struct {
@@ -30,6 +61,15 @@ type PatternRule struct {
     Re          *regexp.Regexp
     Severity    string
     Tags        []string
+    Multiline   bool
+    Key         *regexp.Regexp // set for rules that only see structured values
+    Keywords    []string       // nil means the rule runs on every line
+    Paths       PathFilter
+    AllowValues ValueAllowlist
+    Validate    func(match string) bool // nil when the rule has no validator
+    Downgrade   bool                    // keep matches that fail Validate, at low severity
+    SecretGroup int                     // submatch reported as the secret; 0 is the whole match
+    index       int                     // position in the full rule set, for the prefilter
 }
 
 type EntropyRule struct {
@@ -39,16 +79,38 @@ type EntropyRule struct {
     EntropyThreshold float64
     Severity         string
     Tags             []string
+    Paths            PathFilter
+    AllowValues      ValueAllowlist
+}
+
+type PathFilter struct {
+    Include []string
+    Exclude []string
+}
+
+// Allows reports whether a rule with this filter applies to the file at p.
+func (pf PathFilter) Allows(p string) bool {
+    if len(pf.Include) > 0 && !matchAnyPath(pf.Include, p) {
+        return false
+    }
+    return !matchAnyPath(pf.Exclude, p)
 }
 
 type RuleSet struct {
     SensitiveFilenames []string
     PatternRules       []PatternRule
     EntropyRules       []EntropyRule
+    CompositeRules     []CompositeRule // applied to a scan's findings, see scanner.Correlate
+    AllowlistPaths     []string
+    AllowValues        ValueAllowlist
     entropyTokenRe     *regexp.Regexp
+    NoPrefilter        bool // run every pattern on every line, for benchmarking
+    MaxDecodeDepth     int  // nested encodings MatchDecoded peels off; 0 disables it
+    base               *RuleSet // full rule set a ForPath view was cut from
+    prefilter          *keywordMatcher
 }
 
-func NewRuleSet(files []string, patternCfgs []PatternRuleConfig, entropyCfgs []EntropyRuleConfig) (*RuleSet, error) {
+func NewRuleSet(files []string, patternCfgs []PatternRuleConfig, entropyCfgs []EntropyRuleConfig, allow AllowlistConfig) (*RuleSet, error) {
     rs := &RuleSet{
         SensitiveFilenames: make([]string, len(files)),
         entropyTokenRe:     regexp.MustCompile(`[A-Za-z0-9+/=_\-]{8,}`),
@@ -57,6 +119,16 @@ func NewRuleSet(files []string, patternCfgs []PatternRuleConfig, entropyCfgs []E
         rs.SensitiveFilenames[i] = strings.ToLower(f)
     }
 
+    if err := validateGlobs("allowlist", allow.Paths); err != nil {
+        return nil, err
+    }
+    rs.AllowlistPaths = allow.Paths
+    globalValues, err := newValueAllowlist("allowlist", allow.AllowValues)
+    if err != nil {
+        return nil, err
+    }
+    rs.AllowValues = globalValues
+
     for _, cfg := range patternCfgs {
         if cfg.ID == "" || cfg.Regex == "" {
             return nil, errors.New("pattern rule missing id or regex")
@@ -65,19 +137,80 @@ func NewRuleSet(files []string, patternCfgs []PatternRuleConfig, entropyCfgs []E
         if err != nil {
             return nil, err
         }
+        var key *regexp.Regexp
+        if cfg.KeyRegex != "" {
+            if cfg.Multiline {
+                return nil, fmt.Errorf("%s: key_regex and multiline cannot be combined", cfg.ID)
+            }
+            if key, err = regexp.Compile(cfg.KeyRegex); err != nil {
+                return nil, fmt.Errorf("%s: bad key_regex: %w", cfg.ID, err)
+            }
+        }
+        paths, err := newPathFilter(cfg.ID, cfg.PathFilterConfig)
+        if err != nil {
+            return nil, err
+        }
+        values, err := newValueAllowlist(cfg.ID, cfg.AllowValues)
+        if err != nil {
+            return nil, err
+        }
+        var validate func(string) bool
+        if cfg.Validator != "" {
+            if validate = validatorFor(cfg.Validator); validate == nil {
+                return nil, fmt.Errorf("%s: unknown validator %q", cfg.ID, cfg.Validator)
+            }
+        }
+        switch cfg.OnInvalid {
+        case "", "drop", "downgrade":
+        default:
+            return nil, fmt.Errorf("%s: on_invalid must be drop or downgrade, not %q", cfg.ID, cfg.OnInvalid)
+        }
+        group, err := secretGroup(re, cfg.SecretGroup)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", cfg.ID, err)
+        }
+        keywords := normalizeKeywords(cfg.Keywords)
+        if len(keywords) == 0 {
+            keywords = deriveKeywords(cfg.Regex)
+        }
         rs.PatternRules = append(rs.PatternRules, PatternRule{
             ID:          cfg.ID,
             Description: cfg.Description,
             Re:          re,
             Severity:    cfg.Severity,
             Tags:        cfg.Tags,
+            Multiline:   cfg.Multiline,
+            Key:         key,
+            Keywords:    keywords,
+            index:       len(rs.PatternRules),
+            Paths:       paths,
+            AllowValues: values,
+            Validate:    validate,
+            Downgrade:   cfg.OnInvalid == "downgrade",
+            SecretGroup: group,
         })
     }
 
+    rs.prefilter = newKeywordMatcher()
+    for _, r := range rs.PatternRules {
+        for _, k := range r.Keywords {
+            rs.prefilter.add(k, r.index)
+        }
+    }
+    rs.prefilter.build()
+
     for _, cfg := range entropyCfgs {
         if cfg.ID == "" || cfg.MinLength <= 0 {
             return nil, errors.New("entropy rule missing id or min_length")
         }
+        paths, err := newPathFilter(cfg.ID, cfg.PathFilterConfig)
+        if err != nil {
+            return nil, err
+        }
+        values, err := newValueAllowlist(cfg.ID, cfg.AllowValues)
+        if err != nil {
+            return nil, err
+        }
         rs.EntropyRules = append(rs.EntropyRules, EntropyRule{
             ID:               cfg.ID,
             Description:      cfg.Description,
@@ -85,12 +218,105 @@ func NewRuleSet(files []string, patternCfgs []PatternRuleConfig, entropyCfgs []E
             EntropyThreshold: cfg.EntropyThreshold,
             Severity:         cfg.Severity,
             Tags:             cfg.Tags,
+            Paths:            paths,
+            AllowValues:      values,
         })
     }
 
     return rs, nil
 }
 
+// secretGroup resolves a secret_group setting, a group number or name,
+// to the submatch index of re.
+func secretGroup(re *regexp.Regexp, g string) (int, error) {
+    if g == "" {
+        return 0, nil
+    }
+    if n, err := strconv.Atoi(g); err == nil {
+        if n < 0 || n > re.NumSubexp() {
+            return 0, fmt.Errorf("secret_group %d out of range, regex has %d groups", n, re.NumSubexp())
+        }
+        return n, nil
+    }
+    if n := re.SubexpIndex(g); n > 0 {
+        return n, nil
+    }
+    return 0, fmt.Errorf("secret_group %q is not a named group of the regex", g)
+}
+
+func newPathFilter(id string, cfg PathFilterConfig) (PathFilter, error) {
+    if err := validateGlobs(id+" include_paths", cfg.IncludePaths); err != nil {
+        return PathFilter{}, err
+    }
+    if err := validateGlobs(id+" exclude_paths", cfg.ExcludePaths); err != nil {
+        return PathFilter{}, err
+    }
+    return PathFilter{Include: cfg.IncludePaths, Exclude: cfg.ExcludePaths}, nil
+}
+
+func validateGlobs(where string, patterns []string) error {
+    for _, p := range patterns {
+        if err := glob.Validate(p); err != nil {
+            return fmt.Errorf("%s: bad glob %q: %w", where, p, err)
+        }
+    }
+    return nil
+}
+
+// matchAnyPath matches archive entries (a.zip!/dir/file) as if the archive
+// were a directory.
+func matchAnyPath(patterns []string, p string) bool {
+    p = strings.ReplaceAll(filepath.ToSlash(p), "!/", "/")
+    for _, pat := range patterns {
+        if glob.MatchAnySuffix(pat, p) {
+            return true
+        }
+    }
+    return false
+}
+
+// IsAllowlisted reports whether the global allowlist excludes the file at
+// p from scanning altogether.
+func (rs *RuleSet) IsAllowlisted(p string) bool {
+    return matchAnyPath(rs.AllowlistPaths, p)
+}
+
+// ForPath returns the rules that apply to the file at p. It is always cut
+// from the full rule set, so it can be called again on its own result for
+// files nested in archives.
+func (rs *RuleSet) ForPath(p string) *RuleSet {
+    base := rs
+    if rs.base != nil {
+        base = rs.base
+    }
+    view := &RuleSet{
+        SensitiveFilenames: base.SensitiveFilenames,
+        AllowlistPaths:     base.AllowlistPaths,
+        AllowValues:        base.AllowValues,
+        entropyTokenRe:     base.entropyTokenRe,
+        NoPrefilter:        base.NoPrefilter,
+        MaxDecodeDepth:     base.MaxDecodeDepth,
+        CompositeRules:     base.CompositeRules,
+        base:               base,
+        prefilter:          base.prefilter,
+    }
+    if base.IsAllowlisted(p) {
+        view.SensitiveFilenames = nil
+        return view
+    }
+    for _, r := range base.PatternRules {
+        if r.Paths.Allows(p) {
+            view.PatternRules = append(view.PatternRules, r)
+        }
+    }
+    for _, r := range base.EntropyRules {
+        if r.Paths.Allows(p) {
+            view.EntropyRules = append(view.EntropyRules, r)
+        }
+    }
+    return view
+}
+
 func (rs *RuleSet) IsSensitiveFilename(name string) bool {
     name = strings.ToLower(name)
     for _, f := range rs.SensitiveFilenames {
@@ -105,8 +331,13 @@ type PatternMatch struct {
     RuleID      string
     Description string
     Match       string
+    FullMatch   string // the whole regex match when secret_group narrowed Match
     Severity    string
     Tags        []string
+    Start       int // byte offsets of Match within the scanned text
+    End         int
+    Decoding    []string // encodings Match was found under, outermost first
+    Encoded     string   // for decoded matches, the text at Start:End
 }
 
 type EntropyMatch struct {
@@ -116,36 +347,157 @@ type EntropyMatch struct {
     Entropy     float64
     Severity    string
     Tags        []string
+    Start       int
+    End         int
+}
+
+// candidates reports, per rule index, whether the rule's keywords occur in
+// text. A nil result means every rule must run.
+func (rs *RuleSet) candidates(text string) []bool {
+    if rs.NoPrefilter || rs.prefilter == nil {
+        return nil
+    }
+    n := len(rs.PatternRules)
+    if rs.base != nil {
+        n = len(rs.base.PatternRules)
+    }
+    hits := make([]bool, n)
+    rs.prefilter.match(text, hits)
+    return hits
+}
+
+func (rule PatternRule) skip(hits []bool) bool {
+    return hits != nil && len(rule.Keywords) > 0 && !hits[rule.index]
 }
 
 func (rs *RuleSet) MatchPatterns(line string) []PatternMatch {
     var out []PatternMatch
+    hits := rs.candidates(line)
+    for _, rule := range rs.PatternRules {
+        if rule.Multiline || rule.Key != nil || rule.skip(hits) {
+            continue
+        }
+        out = append(out, rs.allowed(rule, rule.match(line))...)
+    }
+    return out
+}
+
+// MatchMultiline runs the rules marked multiline against a whole file, so
+// their regexes can span line breaks (PEM bodies, YAML block scalars).
+func (rs *RuleSet) MatchMultiline(content string) []PatternMatch {
+    var out []PatternMatch
+    var hits []bool
+    scanned := false
+    for _, rule := range rs.PatternRules {
+        if !rule.Multiline {
+            continue
+        }
+        if !scanned {
+            hits, scanned = rs.candidates(content), true
+        }
+        if rule.skip(hits) {
+            continue
+        }
+        out = append(out, rs.allowed(rule, rule.match(content))...)
+    }
+    return out
+}
+
+// HasKeyRules reports whether any rule targets structured-file keys, i.e.
+// whether structured files are worth parsing.
+func (rs *RuleSet) HasKeyRules() bool {
+    for _, rule := range rs.PatternRules {
+        if rule.Key != nil {
+            return true
+        }
+    }
+    return false
+}
+
+// MatchValue runs the rules with a key_regex against one value read from
+// a structured file. key is the value's own key name, not its full path,
+// so a rule for "password" keys finds database.prod.password too.
+func (rs *RuleSet) MatchValue(key, value string) []PatternMatch {
+    var out []PatternMatch
+    var hits []bool
+    scanned := false
     for _, rule := range rs.PatternRules {
-        matches := rule.Re.FindAllString(line, -1)
-        for _, m := range matches {
-            out = append(out, PatternMatch{
-                RuleID:      rule.ID,
-                Description: rule.Description,
-                Match:       m,
-                Severity:    rule.Severity,
-                Tags:        rule.Tags,
-            })
+        if rule.Key == nil || !rule.Key.MatchString(key) {
+            continue
+        }
+        if !scanned {
+            hits, scanned = rs.candidates(value), true
+        }
+        if rule.skip(hits) {
+            continue
+        }
+        out = append(out, rs.allowed(rule, rule.match(value))...)
+    }
+    return out
+}
+
+// allowed drops matches that the rule's or the global allow_values cover,
+// or, for single-line rules, that are placeholders. Multiline matches are
+// blocks such as PEM bodies, where a marker like "xxxx" turns up by chance.
+func (rs *RuleSet) allowed(rule PatternRule, matches []PatternMatch) []PatternMatch {
+    out := matches[:0]
+    for _, m := range matches {
+        if !rs.isAllowedValue(rule.AllowValues, m.Match, !rule.Multiline) {
+            out = append(out, m)
+        }
+    }
+    return out
+}
+
+func (rs *RuleSet) isAllowedValue(ruleValues ValueAllowlist, match string, placeholders bool) bool {
+    return ruleValues.Matches(match) || rs.AllowValues.Matches(match) || placeholders && IsPlaceholder(match)
+}
+
+func (rule PatternRule) match(text string) []PatternMatch {
+    var out []PatternMatch
+    for _, loc := range rule.Re.FindAllStringSubmatchIndex(text, -1) {
+        // with secret_group only the secret is reported, not the key or
+        // quotes around it; a group that took no part keeps the whole match
+        full := text[loc[0]:loc[1]]
+        if g := rule.SecretGroup; g > 0 && loc[2*g] >= 0 && loc[2*g+1] > loc[2*g] {
+            loc = loc[2*g:]
+        }
+        m := PatternMatch{
+            RuleID:      rule.ID,
+            Description: rule.Description,
+            Match:       text[loc[0]:loc[1]],
+            Severity:    rule.Severity,
+            Tags:        rule.Tags,
+            Start:       loc[0],
+            End:         loc[1],
+        }
+        if full != m.Match {
+            m.FullMatch = full
+        }
+        if rule.Validate != nil && !rule.Validate(m.Match) {
+            if !rule.Downgrade {
+                continue
+            }
+            m.Severity = "low"
+            m.Tags = append(m.Tags[:len(m.Tags):len(m.Tags)], "failed_validation")
         }
+        out = append(out, m)
     }
     return out
 }
 
 func (rs *RuleSet) MatchEntropy(line string) []EntropyMatch {
     var out []EntropyMatch
-    tokens := rs.entropyTokenRe.FindAllString(line, -1)
+    tokens := rs.entropyTokenRe.FindAllStringIndex(line, -1)
 
     for _, rule := range rs.EntropyRules {
-        for _, t := range tokens {
+        for _, loc := range tokens {
+            t := line[loc[0]:loc[1]]
             if len(t) < rule.MinLength {
                 continue
             }
             e := shannonEntropy(t)
-            if e >= rule.EntropyThreshold {
+            if e >= rule.EntropyThreshold && !rs.isAllowedValue(rule.AllowValues, t, true) {
                 out = append(out, EntropyMatch{
                     RuleID:      rule.ID,
                     Description: rule.Description,
@@ -153,6 +505,8 @@ func (rs *RuleSet) MatchEntropy(line string) []EntropyMatch {
                     Entropy:     e,
                     Severity:    rule.Severity,
                     Tags:        rule.Tags,
+                    Start:       loc[0],
+                    End:         loc[1],
                 })
             }
         }
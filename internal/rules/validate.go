@@ -0,0 +1,126 @@
+package rules
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "hash/crc32"
+    "regexp"
+    "strings"
+)
+
+var (
+    githubTokenRe = regexp.MustCompile(`gh[pousr]_([A-Za-z0-9]{30})([A-Za-z0-9]{6})`)
+    npmTokenRe    = regexp.MustCompile(`npm_([A-Za-z0-9]{30})([A-Za-z0-9]{6})`)
+    awsKeyIDRe    = regexp.MustCompile(`(?:A3T[A-Z0-9]|AKIA|ASIA|ABIA|ACCA|AGPA|AIDA|AIPA|ANPA|ANVA|AROA|APKA|ASCA)([A-Z0-9]{16})`)
+    jwtRe         = regexp.MustCompile(`([A-Za-z0-9_-]+)\.([A-Za-z0-9_-]+)\.([A-Za-z0-9_-]*)`)
+)
+
+// validatorFor returns the built-in post-match check called name, or nil.
+// A validator reports whether a match is well-formed beyond what the
+// regex can express; matches that fail are dropped or downgraded.
+func validatorFor(name string) func(match string) bool {
+    switch name {
+    case "github_crc32":
+        return func(m string) bool { return crc32Token(githubTokenRe, m) }
+    case "npm_crc32":
+        return func(m string) bool { return crc32Token(npmTokenRe, m) }
+    case "luhn":
+        return luhn
+    case "jwt":
+        return validJWT
+    case "aws_key_id":
+        return awsKeyID
+    }
+    return nil
+}
+
+const base62Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// crc32Token checks the checksum GitHub and npm tokens end with: the CRC32
+// of the 30 random characters after the prefix, in base62 padded to six
+// digits.
+func crc32Token(re *regexp.Regexp, m string) bool {
+    sub := re.FindStringSubmatch(m)
+    if sub == nil {
+        return false
+    }
+    sum := crc32.ChecksumIEEE([]byte(sub[1]))
+    var digits [6]byte
+    for i := len(digits) - 1; i >= 0; i-- {
+        digits[i] = base62Digits[sum%62]
+        sum /= 62
+    }
+    return string(digits[:]) == sub[2]
+}
+
+// luhn checks the digits of m, ignoring spaces and dashes, against the
+// Luhn checksum used by card numbers.
+func luhn(m string) bool {
+    var digits []int
+    for _, r := range m {
+        switch {
+        case r >= '0' && r <= '9':
+            digits = append(digits, int(r-'0'))
+        case r == ' ' || r == '-':
+        default:
+            return false
+        }
+    }
+    if len(digits) < 12 || len(digits) > 19 {
+        return false
+    }
+    sum := 0
+    for i := range digits {
+        d := digits[len(digits)-1-i]
+        if i%2 == 1 {
+            d *= 2
+            if d > 9 {
+                d -= 9
+            }
+        }
+        sum += d
+    }
+    return sum%10 == 0
+}
+
+// validJWT checks that m holds a JWT whose header and payload decode to
+// JSON objects and whose header names an algorithm. The signature is not
+// verified.
+func validJWT(m string) bool {
+    sub := jwtRe.FindStringSubmatch(m)
+    if sub == nil {
+        return false
+    }
+    var header map[string]any
+    if !decodeJWTPart(sub[1], &header) {
+        return false
+    }
+    if alg, _ := header["alg"].(string); alg == "" {
+        return false
+    }
+    var payload map[string]any
+    return decodeJWTPart(sub[2], &payload)
+}
+
+func decodeJWTPart(s string, v any) bool {
+    b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+    if err != nil {
+        return false
+    }
+    return json.Unmarshal(b, v) == nil
+}
+
+// awsKeyID checks that the 16 characters after an AWS key ID prefix are in
+// the base32 alphabet AWS draws them from (A-Z, 2-7).
+func awsKeyID(m string) bool {
+    sub := awsKeyIDRe.FindStringSubmatch(m)
+    if sub == nil {
+        return false
+    }
+    for _, r := range sub[1] {
+        if !(r >= 'A' && r <= 'Z' || r >= '2' && r <= '7') {
+            return false
+        }
+    }
+    return true
+}
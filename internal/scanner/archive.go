@@ -0,0 +1,183 @@
+package scanner
+
+import (
+    "archive/tar"
+    "archive/zip"
+    "bytes"
+    "compress/bzip2"
+    "compress/gzip"
+    "errors"
+    "fmt"
+    "io"
+    "path"
+    "strings"
+
+    "superscan/internal/rules"
+)
+
+// archivePathSep joins an archive's path to the path of an entry inside it,
+// e.g. dist/app.jar!/config/application.properties.
+const archivePathSep = "!/"
+
+var errArchiveBudget = errors.New("decompressed size limit reached")
+
+func archiveKind(b []byte) string {
+    switch {
+    case bytes.HasPrefix(b, []byte("PK\x03\x04")), bytes.HasPrefix(b, []byte("PK\x05\x06")):
+        return "zip"
+    case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+        return "gzip"
+    case bytes.HasPrefix(b, []byte("BZh")):
+        return "bzip2"
+    case len(b) > 262 && bytes.Equal(b[257:262], []byte("ustar")):
+        return "tar"
+    }
+    return ""
+}
+
+// scanArchive unpacks raw in memory and scans each entry. budget is shared
+// by every nesting level of one top-level file so that a zip bomb cannot
+// expand past MaxArchiveBytes in total.
+func scanArchive(p string, raw []byte, rs *rules.RuleSet, opts Options, depth int, budget *int64) []Finding {
+    var out []Finding
+    var err error
+
+    switch archiveKind(raw) {
+    case "zip":
+        out, err = scanZip(p, raw, rs, opts, depth, budget)
+    case "tar":
+        out, err = scanTar(p, raw, rs, opts, depth, budget)
+    case "gzip", "bzip2":
+        // single-stream compression is transparent: x.tar.gz lists its tar
+        // entries directly, and a compressed text file keeps its own path
+        var data []byte
+        data, err = decompress(raw, budget)
+        if err == nil {
+            out = scanNested(p, data, rs, opts, depth, budget)
+        }
+    }
+
+    if err != nil {
+        rule, desc := "archive_error", "Error reading archive: "+err.Error()
+        if errors.Is(err, errArchiveBudget) {
+            rule = "archive_limit"
+            desc = fmt.Sprintf("Archive exceeds %d decompressed bytes; remaining entries skipped", opts.MaxArchiveBytes)
+        }
+        out = append(out, Finding{
+            File:        p,
+            RuleID:      rule,
+            Description: desc,
+            Type:        "error",
+            Severity:    "low",
+        })
+    }
+    return out
+}
+
+func scanNested(p string, data []byte, rs *rules.RuleSet, opts Options, depth int, budget *int64) []Finding {
+    if archiveKind(data) == "" {
+        return scanText(p, data, rs)
+    }
+    if depth >= opts.MaxArchiveDepth {
+        return []Finding{{
+            File:        p,
+            RuleID:      "archive_limit",
+            Description: fmt.Sprintf("Nested archive deeper than %d levels not scanned", opts.MaxArchiveDepth),
+            Type:        "error",
+            Severity:    "low",
+        }}
+    }
+    return scanArchive(p, data, rs, opts, depth+1, budget)
+}
+
+func scanEntry(archivePath, name string, data []byte, rs *rules.RuleSet, opts Options, depth int, budget *int64) []Finding {
+    var out []Finding
+    name = strings.TrimPrefix(path.Clean("/"+name), "/")
+    entryPath := archivePath + archivePathSep + name
+    if rs.IsAllowlisted(entryPath) {
+        return out
+    }
+    rs = rs.ForPath(entryPath)
+    if rs.IsSensitiveFilename(path.Base(name)) {
+        out = append(out, filenameFinding(entryPath, path.Base(name)))
+    }
+    return append(out, scanNested(entryPath, data, rs, opts, depth, budget)...)
+}
+
+func scanZip(p string, raw []byte, rs *rules.RuleSet, opts Options, depth int, budget *int64) ([]Finding, error) {
+    zr, err := zip.NewReader(bytes.NewReader(raw), int64(len(raw)))
+    if err != nil {
+        return nil, err
+    }
+    var out []Finding
+    for _, f := range zr.File {
+        if f.FileInfo().IsDir() {
+            continue
+        }
+        rc, err := f.Open()
+        if err != nil {
+            return out, fmt.Errorf("%s: %w", f.Name, err)
+        }
+        data, err := readLimited(rc, budget)
+        rc.Close()
+        if err != nil {
+            return out, err
+        }
+        out = append(out, scanEntry(p, f.Name, data, rs, opts, depth, budget)...)
+    }
+    return out, nil
+}
+
+func scanTar(p string, raw []byte, rs *rules.RuleSet, opts Options, depth int, budget *int64) ([]Finding, error) {
+    tr := tar.NewReader(bytes.NewReader(raw))
+    var out []Finding
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return out, nil
+        }
+        if err != nil {
+            return out, err
+        }
+        if hdr.Typeflag != tar.TypeReg {
+            continue
+        }
+        data, err := readLimited(tr, budget)
+        if err != nil {
+            return out, err
+        }
+        out = append(out, scanEntry(p, hdr.Name, data, rs, opts, depth, budget)...)
+    }
+}
+
+func decompress(raw []byte, budget *int64) ([]byte, error) {
+    var r io.Reader
+    switch archiveKind(raw) {
+    case "gzip":
+        zr, err := gzip.NewReader(bytes.NewReader(raw))
+        if err != nil {
+            return nil, err
+        }
+        defer zr.Close()
+        r = zr
+    case "bzip2":
+        r = bzip2.NewReader(bytes.NewReader(raw))
+    }
+    return readLimited(r, budget)
+}
+
+func readLimited(r io.Reader, budget *int64) ([]byte, error) {
+    if *budget <= 0 {
+        return nil, errArchiveBudget
+    }
+    data, err := io.ReadAll(io.LimitReader(r, *budget+1))
+    if err != nil {
+        return nil, err
+    }
+    if int64(len(data)) > *budget {
+        *budget = 0
+        return nil, errArchiveBudget
+    }
+    *budget -= int64(len(data))
+    return data, nil
+}
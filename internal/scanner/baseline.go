@@ -6,20 +6,30 @@ import (
     "encoding/json"
     "fmt"
     "os"
+    "strings"
 )
 
+const BaselineVersion = 2
+
 type BaselineEntry struct {
-    Fingerprint string `json:"fingerprint"`
-    RuleID      string `json:"rule_id"`
-    Comment     string `json:"comment,omitempty"`
+    Fingerprint       string `json:"fingerprint,omitempty"`
+    LegacyFingerprint string `json:"legacy_fingerprint,omitempty"` // version 1 entry not yet matched
+    Context           string `json:"context,omitempty"`
+    RuleID            string `json:"rule_id"`
+    Comment           string `json:"comment,omitempty"`
 }
 
 type Baseline struct {
     Version int             `json:"version"`
     Entries []BaselineEntry `json:"entries"`
-    lookup  map[string]BaselineEntry
+    lookup  map[string][]int
+    legacy  map[string]int
+    dirty   bool
 }
 
+// LoadBaseline reads a baseline file. Version 1 files, whose fingerprints
+// include the line number, are migrated in memory: their entries are kept
+// as legacy fingerprints and upgraded as soon as a finding matches them.
 func LoadBaseline(path string) (*Baseline, error) {
     data, err := os.ReadFile(path)
     if err != nil {
@@ -29,51 +39,149 @@ func LoadBaseline(path string) (*Baseline, error) {
     if err := json.Unmarshal(data, &b); err != nil {
         return nil, err
     }
-    b.lookup = make(map[string]BaselineEntry, len(b.Entries))
-    for _, e := range b.Entries {
-        b.lookup[e.Fingerprint] = e
+    if b.Version > BaselineVersion {
+        return nil, fmt.Errorf("baseline version %d is newer than supported version %d", b.Version, BaselineVersion)
+    }
+    if b.Version < 2 {
+        for i := range b.Entries {
+            b.Entries[i].LegacyFingerprint = b.Entries[i].Fingerprint
+            b.Entries[i].Fingerprint = ""
+        }
+        b.Version = BaselineVersion
+        b.dirty = true
     }
+    b.index()
     return &b, nil
 }
 
+func (b *Baseline) index() {
+    b.lookup = make(map[string][]int, len(b.Entries))
+    b.legacy = make(map[string]int)
+    for i, e := range b.Entries {
+        if e.Fingerprint != "" {
+            b.lookup[e.Fingerprint] = append(b.lookup[e.Fingerprint], i)
+        }
+        if e.LegacyFingerprint != "" {
+            b.legacy[e.LegacyFingerprint] = i
+        }
+    }
+}
+
 func (b *Baseline) IsIgnored(f Finding) bool {
     if b == nil {
         return false
     }
-    _, ok := b.lookup[f.Fingerprint]
-    return ok
+    for _, i := range b.lookup[f.Fingerprint] {
+        ctx := b.Entries[i].Context
+        if ctx == "" || ctx == BuildContextHash(f) {
+            return true
+        }
+    }
+
+    i, ok := b.legacy[BuildLegacyFingerprint(f)]
+    if !ok {
+        return false
+    }
+    e := &b.Entries[i]
+    e.Fingerprint = f.Fingerprint
+    if e.Fingerprint == "" {
+        e.Fingerprint = BuildFingerprint(f)
+    }
+    delete(b.legacy, e.LegacyFingerprint)
+    e.LegacyFingerprint = ""
+    b.lookup[e.Fingerprint] = append(b.lookup[e.Fingerprint], i)
+    b.dirty = true
+    return true
+}
+
+// Migrated reports whether the baseline changed since it was loaded, i.e.
+// it came from an older format or legacy entries were upgraded.
+func (b *Baseline) Migrated() bool {
+    return b != nil && b.dirty
+}
+
+func (b *Baseline) Save(path string) error {
+    data, err := json.MarshalIndent(b, "", "  ")
+    if err != nil {
+        return err
+    }
+    return os.WriteFile(path, data, 0644)
 }
 
+// BuildFingerprint identifies a finding by rule, file and secret value, so
+// it survives the secret moving to another line.
 func BuildFingerprint(f Finding) string {
+    value := f.Match
+    if value == "" {
+        value = f.Snippet
+    }
     h := sha1.New()
-    fmt.Fprintf(h, "%s|%d|%s|%s", f.File, f.Line, f.RuleID, f.Match)
+    fmt.Fprintf(h, "v2|%s|%s|%s", f.RuleID, f.File, value)
     return hex.EncodeToString(h.Sum(nil))[:16]
 }
 
-func WriteBaseline(path string, findings []Finding) error {
+// BuildLegacyFingerprint is the version 1 fingerprint, which also hashed
+// the line number. It is only used to match old baseline entries.
+func BuildLegacyFingerprint(f Finding) string {
+    h := sha1.New()
+    fmt.Fprintf(h, "%s|%d|%s|%s", f.File, f.Line, f.RuleID, legacyMatch(f))
+    return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// legacyMatch is the match text version 1 reported for f: rules had no
+// secret_group then, and private_key_block matched only its header line.
+func legacyMatch(f Finding) string {
+    if f.FullMatch != "" {
+        return f.FullMatch
+    }
+    if f.RuleID == "private_key_block" {
+        first, _, _ := strings.Cut(f.Match, "\n")
+        return strings.TrimSuffix(first, "\r")
+    }
+    return f.Match
+}
+
+// BuildContextHash hashes the line around the secret, with the secret
+// itself removed and whitespace collapsed. Baseline entries that carry it
+// only match while the surrounding code is unchanged.
+func BuildContextHash(f Finding) string {
+    ctx := f.Snippet
+    if f.Encoded != "" {
+        ctx = strings.ReplaceAll(ctx, f.Encoded, "")
+    } else if f.Match != "" {
+        ctx = strings.ReplaceAll(ctx, f.Match, "")
+    }
+    h := sha1.New()
+    fmt.Fprint(h, strings.Join(strings.Fields(ctx), " "))
+    return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// WriteBaseline records findings in the version 2 format. With
+// withContext set, each entry also pins the surrounding line content.
+func WriteBaseline(path string, findings []Finding, withContext bool) error {
     b := Baseline{
-        Version: 1,
+        Version: BaselineVersion,
     }
 
-    seen := make(map[string]bool)
+    seen := make(map[BaselineEntry]bool)
     for _, f := range findings {
         fp := f.Fingerprint
         if fp == "" {
             fp = BuildFingerprint(f)
         }
-        if seen[fp] {
-            continue
-        }
-        seen[fp] = true
-        b.Entries = append(b.Entries, BaselineEntry{
+        e := BaselineEntry{
             Fingerprint: fp,
             RuleID:      f.RuleID,
-        })
+        }
+        if withContext {
+            e.Context = BuildContextHash(f)
+        }
+        if seen[e] {
+            continue
+        }
+        seen[e] = true
+        b.Entries = append(b.Entries, e)
     }
 
-    data, err := json.MarshalIndent(b, "", "  ")
-    if err != nil {
-        return err
-    }
-    return os.WriteFile(path, data, 0644)
+    return b.Save(path)
 }
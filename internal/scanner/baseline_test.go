@@ -0,0 +1,91 @@
+package scanner
+
+import (
+    "os"
+    "path/filepath"
+    "testing"
+
+    "gopkg.in/yaml.v3"
+
+    "superscan/internal/rules"
+)
+
+// shippedRuleSet builds the rules of the config.yml at the repo root.
+func shippedRuleSet(t *testing.T) *rules.RuleSet {
+    t.Helper()
+    raw, err := os.ReadFile("../../config.yml")
+    if err != nil {
+        t.Fatal(err)
+    }
+    var cfg struct {
+        SensitiveFiles []string                  `yaml:"sensitive_filenames"`
+        PatternRules   []rules.PatternRuleConfig `yaml:"patterns"`
+        EntropyRules   []rules.EntropyRuleConfig `yaml:"entropy_rules"`
+        Allowlist      rules.AllowlistConfig     `yaml:"allowlist"`
+    }
+    if err := yaml.Unmarshal(raw, &cfg); err != nil {
+        t.Fatal(err)
+    }
+    rs, err := rules.NewRuleSet(cfg.SensitiveFiles, cfg.PatternRules, cfg.EntropyRules, cfg.Allowlist)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return rs
+}
+
+// testdata/v1/baseline.json was written by the version 1 release with
+// `superscan -baseline testdata/v1/baseline.json -baseline-create
+// testdata/v1/src`, run from this directory.
+func TestLoadBaselineMigratesVersion1(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "baseline.json")
+    raw, err := os.ReadFile("testdata/v1/baseline.json")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, raw, 0644); err != nil {
+        t.Fatal(err)
+    }
+    b, err := LoadBaseline(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    findings, err := Scan("testdata/v1/src", shippedRuleSet(t), Options{Workers: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    seen := make(map[string]bool)
+    for _, f := range findings {
+        f.Fingerprint = BuildFingerprint(f)
+        seen[f.RuleID] = true
+        if !b.IsIgnored(f) {
+            t.Errorf("%s:%d %s not matched by the version 1 baseline", f.File, f.Line, f.RuleID)
+        }
+    }
+    for _, id := range []string{"private_key_block", "azure_client_secret"} {
+        if !seen[id] {
+            t.Errorf("no %s finding; the fixture is not exercising it", id)
+        }
+    }
+    if !b.Migrated() {
+        t.Error("baseline not reported as migrated")
+    }
+
+    // once saved, the upgraded entries match by the version 2 fingerprint
+    if err := b.Save(path); err != nil {
+        t.Fatal(err)
+    }
+    b, err = LoadBaseline(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, f := range findings {
+        f.Fingerprint = BuildFingerprint(f)
+        if !b.IsIgnored(f) {
+            t.Errorf("%s:%d %s not matched after saving the migrated baseline", f.File, f.Line, f.RuleID)
+        }
+    }
+    if b.Migrated() {
+        t.Error("saved baseline still needs migrating")
+    }
+}
@@ -0,0 +1,169 @@
+package scanner
+
+import (
+    "sort"
+    "strings"
+
+    "superscan/internal/rules"
+)
+
+// Correlate applies the composite rules of rs to the findings of a scan.
+// Findings that together satisfy a composite rule are replaced by a single
+// finding for it, listing them as Related. Findings only combine within
+// one file, and in history and image scans within one commit or layer.
+// Suppressed findings never take part.
+func Correlate(findings []Finding, rs *rules.RuleSet) []Finding {
+    for _, c := range rs.CompositeRules {
+        findings = correlate(findings, c)
+    }
+    return findings
+}
+
+func correlate(findings []Finding, c rules.CompositeRule) []Finding {
+    wanted := make(map[string]bool, len(c.Rules))
+    for _, id := range c.Rules {
+        wanted[id] = true
+    }
+    groups := make(map[string][]int) // file, commit and layer -> indexes of candidate parts
+    var order []string
+    for i, f := range findings {
+        if !wanted[f.RuleID] || f.Suppressed || f.Type == "error" || f.Type == "skipped" {
+            continue
+        }
+        key := f.File + "\x00" + f.Commit + "\x00" + f.Layer
+        if groups[key] == nil {
+            order = append(order, key)
+        }
+        groups[key] = append(groups[key], i)
+    }
+
+    used := make(map[int]bool)
+    composites := make(map[int][]Finding) // earliest part -> composites taking its place
+    for _, key := range order {
+        idx := groups[key]
+        sort.SliceStable(idx, func(a, b int) bool {
+            fa, fb := findings[idx[a]], findings[idx[b]]
+            if fa.Line != fb.Line {
+                return fa.Line < fb.Line
+            }
+            return fa.StartColumn < fb.StartColumn
+        })
+        for _, anchor := range idx {
+            if used[anchor] {
+                continue
+            }
+            parts := pickParts(findings, idx, anchor, c, used)
+            if parts == nil {
+                if c.WithinLines == 0 {
+                    break // the whole file was the window
+                }
+                continue
+            }
+            at := parts[0]
+            for _, i := range parts {
+                used[i] = true
+                if i < at {
+                    at = i
+                }
+            }
+            composites[at] = append(composites[at], compositeFinding(findings, parts, c))
+        }
+    }
+    if len(composites) == 0 {
+        return findings
+    }
+
+    out := make([]Finding, 0, len(findings))
+    for i, f := range findings {
+        out = append(out, composites[i]...)
+        if !used[i] {
+            out = append(out, f)
+        }
+    }
+    return out
+}
+
+// pickParts finds one unused finding for each rule of c in the window
+// that opens at the anchor finding, or returns nil if a rule has none.
+// The anchor always takes part.
+func pickParts(findings []Finding, idx []int, anchor int, c rules.CompositeRule, used map[int]bool) []int {
+    first := findings[anchor].Line
+    parts := []int{anchor}
+    for _, id := range c.Rules {
+        if id == findings[anchor].RuleID {
+            continue
+        }
+        found := -1
+        for _, i := range idx {
+            f := findings[i]
+            if c.WithinLines > 0 && f.Line < first {
+                continue
+            }
+            if c.WithinLines > 0 && f.Line > first+c.WithinLines {
+                break
+            }
+            if f.RuleID == id && !used[i] {
+                found = i
+                break
+            }
+        }
+        if found < 0 {
+            return nil
+        }
+        parts = append(parts, found)
+    }
+    sort.Slice(parts, func(a, b int) bool {
+        fa, fb := findings[parts[a]], findings[parts[b]]
+        if fa.Line != fb.Line {
+            return fa.Line < fb.Line
+        }
+        return fa.StartColumn < fb.StartColumn
+    })
+    return parts
+}
+
+// compositeFinding spans its parts, from the first to the last. Match
+// holds every part's match, one per line, so the fingerprint and
+// redaction cover all of them.
+func compositeFinding(findings []Finding, parts []int, c rules.CompositeRule) Finding {
+    first, last := findings[parts[0]], findings[parts[len(parts)-1]]
+    f := Finding{
+        File:        first.File,
+        Line:        first.Line,
+        StartColumn: first.StartColumn,
+        StartOffset: first.StartOffset,
+        RuleID:      c.ID,
+        Description: c.Description,
+        Snippet:     first.Snippet,
+        Type:        "composite",
+        Tags:        c.Tags,
+        Commit:      first.Commit,
+        Author:      first.Author,
+        Email:       first.Email,
+        Date:        first.Date,
+        Layer:       first.Layer,
+        RemovedIn:   first.RemovedIn,
+    }
+    if last.Line > first.Line {
+        f.EndLine = last.Line
+    }
+    f.EndColumn = last.EndColumn
+    if first.EndOffset > 0 && last.EndOffset > 0 {
+        f.EndOffset = last.EndOffset
+    } else {
+        f.StartOffset = 0
+    }
+
+    var matches, severities []string
+    for _, i := range parts {
+        p := findings[i]
+        if p.Match != "" {
+            matches = append(matches, p.Match)
+        }
+        severities = append(severities, p.Severity)
+        f.Related = append(f.Related, p)
+    }
+    f.Match = strings.Join(matches, "\n")
+    f.Severity = c.CombinedSeverity(severities)
+    return f
+}
@@ -0,0 +1,258 @@
+package scanner
+
+import (
+    "fmt"
+    "path"
+    "strings"
+    "sync"
+    "time"
+
+    "superscan/internal/git"
+    "superscan/internal/rules"
+)
+
+type blobJob struct {
+    commit *git.Commit // nil for changes that are not yet committed
+    change git.Change
+}
+
+// ScanHistory scans the lines added by every commit reachable from any ref
+// in the repository at repoPath, reading objects directly from .git.
+func ScanHistory(repoPath string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
+    repo, err := git.Open(repoPath)
+    if err != nil {
+        return nil, err
+    }
+    defer repo.Close()
+
+    refs, err := repo.Refs()
+    if err != nil {
+        return nil, err
+    }
+    var tips []git.Hash
+    for _, ref := range refs {
+        h, err := repo.Peel(ref.Hash)
+        if err != nil {
+            // refs to trees or blobs have no history to walk
+            continue
+        }
+        tips = append(tips, h)
+    }
+
+    commits, err := repo.Log(tips, nil)
+    if err != nil {
+        return nil, err
+    }
+    return scanCommits(repo, commits, rs, opts)
+}
+
+// ScanRange scans the lines added by commits reachable from until but not
+// from since, the same set `git log since..until` shows. An empty since
+// means the full history of until; an empty until means HEAD.
+func ScanRange(repoPath, since, until string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
+    repo, err := git.Open(repoPath)
+    if err != nil {
+        return nil, err
+    }
+    defer repo.Close()
+
+    if until == "" {
+        until = "HEAD"
+    }
+    head, err := repo.Resolve(until)
+    if err != nil {
+        return nil, err
+    }
+    var exclude []git.Hash
+    if since != "" {
+        base, err := repo.Resolve(since)
+        if err != nil {
+            return nil, err
+        }
+        exclude = append(exclude, base)
+    }
+
+    commits, err := repo.Log([]git.Hash{head}, exclude)
+    if err != nil {
+        return nil, err
+    }
+    return scanCommits(repo, commits, rs, opts)
+}
+
+func scanCommits(repo *git.Repo, commits []*git.Commit, rs *rules.RuleSet, opts Options) ([]Finding, error) {
+    ignored := make(map[string]struct{})
+    for _, d := range opts.IgnoreDirs {
+        ignored[d] = struct{}{}
+    }
+
+    var jobs []blobJob
+    for _, c := range commits {
+        // like `git log -p`, merges are skipped: their content was already
+        // introduced by the commits being merged
+        if len(c.Parents) > 1 {
+            continue
+        }
+        var parentTree git.Hash
+        if len(c.Parents) == 1 {
+            parent, err := repo.ReadCommit(c.Parents[0])
+            if err != nil {
+                return nil, err
+            }
+            parentTree = parent.Tree
+        }
+
+        changes, err := repo.DiffTrees(parentTree, c.Tree)
+        if err != nil {
+            return nil, fmt.Errorf("commit %s: %w", c.Hash, err)
+        }
+        for _, ch := range changes {
+            if inIgnoredDir(ch.Path, ignored) || inIgnoredPath(ch.Path, opts.IgnorePaths) {
+                continue
+            }
+            jobs = append(jobs, blobJob{commit: c, change: ch})
+        }
+    }
+
+    return scanBlobJobs(repo, jobs, rs, opts), nil
+}
+
+func scanBlobJobs(repo *git.Repo, jobs []blobJob, rs *rules.RuleSet, opts Options) []Finding {
+    if opts.Workers <= 0 {
+        opts.Workers = 4
+    }
+    var findingsMu sync.Mutex
+    var findings []Finding
+
+    jobCh := make(chan blobJob, opts.Workers*2)
+    var wg sync.WaitGroup
+
+    for i := 0; i < opts.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := range jobCh {
+                fs := scanChange(repo, j.change, rs, opts)
+                if j.commit != nil {
+                    for k := range fs {
+                        attachCommit(&fs[k], j.commit)
+                    }
+                }
+                if len(fs) > 0 {
+                    findingsMu.Lock()
+                    findings = append(findings, fs...)
+                    findingsMu.Unlock()
+                }
+            }
+        }()
+    }
+
+    for _, j := range jobs {
+        jobCh <- j
+    }
+    close(jobCh)
+    wg.Wait()
+
+    return findings
+}
+
+func scanChange(repo *git.Repo, ch git.Change, rs *rules.RuleSet, opts Options) []Finding {
+    var out []Finding
+
+    if rs.IsAllowlisted(ch.Path) {
+        return out
+    }
+    rs = rs.ForPath(ch.Path)
+
+    if ch.From.IsZero() && rs.IsSensitiveFilename(path.Base(ch.Path)) {
+        out = append(out, filenameFinding(ch.Path, path.Base(ch.Path)))
+    }
+
+    raw, err := repo.ReadBlob(ch.To)
+    if err != nil {
+        out = append(out, Finding{
+            File:        ch.Path,
+            RuleID:      "read_error",
+            Description: err.Error(),
+            Type:        "error",
+            Severity:    "low",
+        })
+        return out
+    }
+    if opts.MaxFileSizeBytes > 0 && int64(len(raw)) > opts.MaxFileSizeBytes {
+        return append(out, skippedFinding(ch.Path, "skipped_size", fmt.Sprintf("file is %d bytes, over max_file_size_bytes (%d)", len(raw), opts.MaxFileSizeBytes)))
+    }
+    if looksBinary(raw) {
+        return append(out, skippedFinding(ch.Path, "skipped_binary", "binary file"))
+    }
+
+    var oldLines []string
+    if !ch.From.IsZero() {
+        prev, err := repo.ReadBlob(ch.From)
+        if err == nil && !looksBinary(prev) {
+            oldLines = git.SplitLines(prev)
+        }
+    }
+    newLines := git.SplitLines(raw)
+
+    added := make(map[int]bool)
+    addedLines := git.AddedLines(oldLines, newLines)
+    for _, i := range addedLines {
+        added[i+1] = true
+    }
+    // a multiline block counts as introduced if any of its lines is new
+    introduced := func(start, end int) bool {
+        for l := start; l <= end; l++ {
+            if added[l] {
+                return true
+            }
+        }
+        return false
+    }
+
+    if isNotebook(ch.Path) {
+        if nb, ok := scanNotebook(ch.Path, raw, rs, introduced); ok {
+            return append(out, nb...)
+        }
+    }
+
+    offsets := lineOffsets(raw)
+    for _, i := range addedLines {
+        out = append(out, scanLine(ch.Path, i+1, offsets[i], newLines[i], rs)...)
+    }
+    out = append(out, scanMultiline(ch.Path, raw, rs, introduced)...)
+    out = append(out, scanStructured(ch.Path, raw, rs, func(line int) bool { return added[line] })...)
+    out = scanManifests(ch.Path, raw, rs, introduced, out)
+
+    applySuppressions(out, suppressionsIn(raw))
+    return out
+}
+
+func attachCommit(f *Finding, c *git.Commit) {
+    f.Commit = c.Hash.String()
+    f.Author = c.Author.Name
+    f.Email = c.Author.Email
+    if !c.Author.When.IsZero() {
+        f.Date = c.Author.When.Format(time.RFC3339)
+    }
+}
+
+// inIgnoredPath applies ignore_paths globs to a repository path and each of
+// its parent directories, as a directory walk would have.
+func inIgnoredPath(p string, patterns []string) bool {
+    for ; p != "."; p = path.Dir(p) {
+        if matchIgnorePath(patterns, p) {
+            return true
+        }
+    }
+    return false
+}
+
+func inIgnoredDir(p string, ignored map[string]struct{}) bool {
+    parts := strings.Split(p, "/")
+    for _, dir := range parts[:len(parts)-1] {
+        if _, ok := ignored[dir]; ok {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,144 @@
+package scanner
+
+import (
+    "bufio"
+    "os"
+    "path"
+    "path/filepath"
+    "strings"
+
+    "superscan/internal/glob"
+)
+
+// ignoreFileName is superscan's own ignore file. It uses .gitignore syntax
+// and, in the same directory, takes precedence over .gitignore.
+const ignoreFileName = ".superscanignore"
+
+type ignorePattern struct {
+    glob     string
+    negate   bool
+    dirOnly  bool
+    anchored bool // matched against the path relative to its file, not the base name
+}
+
+// ignoreRules holds the patterns of every ignore file seen during a walk,
+// keyed by the slash-separated directory (relative to the scan root, "" for
+// the root itself) they were read from.
+type ignoreRules struct {
+    root      string
+    gitignore bool
+    byDir     map[string][]ignorePattern
+}
+
+func newIgnoreRules(root string, gitignore bool) *ignoreRules {
+    ir := &ignoreRules{
+        root:      root,
+        gitignore: gitignore,
+        byDir:     make(map[string][]ignorePattern),
+    }
+    if gitignore {
+        ir.byDir[""] = readIgnoreFile(filepath.Join(root, ".git", "info", "exclude"))
+    }
+    return ir
+}
+
+// enter loads the ignore files of a directory the walk is about to descend
+// into. Patterns from later files win, so .superscanignore comes last.
+func (ir *ignoreRules) enter(rel, abs string) {
+    var pats []ignorePattern
+    if ir.gitignore {
+        pats = append(pats, readIgnoreFile(filepath.Join(abs, ".gitignore"))...)
+    }
+    pats = append(pats, readIgnoreFile(filepath.Join(abs, ignoreFileName))...)
+    if len(pats) > 0 {
+        ir.byDir[rel] = append(ir.byDir[rel], pats...)
+    }
+}
+
+// ignored reports whether the path rel (slash-separated, relative to the
+// root) is excluded. As in git, the deepest ignore file decides and within
+// a file the last matching pattern wins.
+func (ir *ignoreRules) ignored(rel string, isDir bool) bool {
+    dir := rel
+    for dir != "" {
+        dir = path.Dir(dir)
+        if dir == "." {
+            dir = ""
+        }
+        pats := ir.byDir[dir]
+        sub := rel
+        if dir != "" {
+            sub = rel[len(dir)+1:]
+        }
+        for i := len(pats) - 1; i >= 0; i-- {
+            if pats[i].matches(sub, isDir) {
+                return !pats[i].negate
+            }
+        }
+    }
+    return false
+}
+
+func (p ignorePattern) matches(rel string, isDir bool) bool {
+    if p.dirOnly && !isDir {
+        return false
+    }
+    if p.anchored {
+        return glob.Match(p.glob, rel)
+    }
+    return glob.Match(p.glob, path.Base(rel))
+}
+
+func readIgnoreFile(name string) []ignorePattern {
+    f, err := os.Open(name)
+    if err != nil {
+        return nil
+    }
+    defer f.Close()
+
+    var pats []ignorePattern
+    sc := bufio.NewScanner(f)
+    for sc.Scan() {
+        if p, ok := parseIgnoreLine(sc.Text()); ok {
+            pats = append(pats, p)
+        }
+    }
+    return pats
+}
+
+// parseIgnoreLine converts one line of .gitignore syntax into a pattern.
+func parseIgnoreLine(line string) (ignorePattern, bool) {
+    line = strings.TrimSuffix(line, "\r")
+    // trailing spaces are dropped unless escaped with a backslash
+    for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+        line = line[:len(line)-1]
+    }
+    if line == "" || line[0] == '#' {
+        return ignorePattern{}, false
+    }
+
+    var p ignorePattern
+    if line[0] == '!' {
+        p.negate = true
+        line = line[1:]
+    } else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+        line = line[1:]
+    }
+    if strings.HasSuffix(line, "/") {
+        p.dirOnly = true
+        line = strings.TrimRight(line, "/")
+    }
+    if line == "" {
+        return ignorePattern{}, false
+    }
+    // a slash anywhere but the end ties the pattern to its directory
+    if strings.Contains(line, "/") {
+        p.anchored = true
+        line = strings.TrimPrefix(line, "/")
+    }
+
+    // gitignore has no brace expansion and spells class negation [!...]
+    line = strings.NewReplacer("{", "\\{", "}", "\\}", "[!", "[^").Replace(line)
+    p.glob = line
+    return p, true
+}
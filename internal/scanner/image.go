@@ -0,0 +1,217 @@
+package scanner
+
+import (
+    "archive/tar"
+    "bytes"
+    "fmt"
+    "io"
+    "path"
+    "strings"
+    "sync"
+
+    "superscan/internal/image"
+    "superscan/internal/rules"
+)
+
+type imageJob struct {
+    layer    string
+    name     string
+    data     []byte
+    size     int64
+    tooLarge bool // over MaxFileSizeBytes; data was not read
+}
+
+// layerWhiteout is a deletion recorded by a layer: target itself, or with
+// opaque set everything below the directory target.
+type layerWhiteout struct {
+    target string
+    opaque bool
+}
+
+// ScanImage scans every file of every layer of the OCI image layout or
+// `docker save` archive at imagePath. Layers are scanned one by one rather
+// than as the final filesystem, so files deleted by a later layer are still
+// reported, marked with the layer that removed them.
+func ScanImage(imagePath string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
+    img, err := image.Open(imagePath)
+    if err != nil {
+        return nil, err
+    }
+    defer img.Close()
+
+    if opts.Workers <= 0 {
+        opts.Workers = 4
+    }
+    if opts.MaxArchiveBytes <= 0 {
+        opts.MaxArchiveBytes = 100 << 20
+    }
+    ignored := make(map[string]struct{})
+    for _, d := range opts.IgnoreDirs {
+        ignored[d] = struct{}{}
+    }
+
+    var findingsMu sync.Mutex
+    var findings []Finding
+
+    jobCh := make(chan imageJob, opts.Workers*2)
+    var wg sync.WaitGroup
+    for i := 0; i < opts.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := range jobCh {
+                fs := scanImageEntry(imagePath, j, rs, opts)
+                if len(fs) > 0 {
+                    findingsMu.Lock()
+                    findings = append(findings, fs...)
+                    findingsMu.Unlock()
+                }
+            }
+        }()
+    }
+
+    // a layer shared by several manifests is scanned once; whiteouts are
+    // judged against the first manifest it appears in
+    scanned := make(map[string]bool)
+    removedIn := make(map[string][]string) // layer -> later layers, in order
+    whiteouts := make(map[string][]layerWhiteout)
+    for _, m := range img.Manifests {
+        var earlier []string
+        for _, l := range m.Layers {
+            if !scanned[l.Digest] {
+                scanned[l.Digest] = true
+                wo, errFinding := readLayer(img, l, imagePath, ignored, opts, jobCh)
+                whiteouts[l.Digest] = wo
+                if errFinding != nil {
+                    findingsMu.Lock()
+                    findings = append(findings, *errFinding)
+                    findingsMu.Unlock()
+                }
+                for _, e := range earlier {
+                    removedIn[e] = append(removedIn[e], l.Digest)
+                }
+            }
+            earlier = append(earlier, l.Digest)
+        }
+    }
+    close(jobCh)
+    wg.Wait()
+
+    prefix := imagePath + archivePathSep
+    for i := range findings {
+        f := &findings[i]
+        if f.Layer == "" || f.Type == "error" {
+            continue
+        }
+        inImage := strings.TrimPrefix(f.File, prefix)
+        // nested archive entries are deleted along with their archive
+        inImage, _, _ = strings.Cut(inImage, archivePathSep)
+    later:
+        for _, l := range removedIn[f.Layer] {
+            for _, w := range whiteouts[l] {
+                if w.deletes(inImage) {
+                    f.RemovedIn = l
+                    break later
+                }
+            }
+        }
+    }
+    return findings, nil
+}
+
+func (w layerWhiteout) deletes(p string) bool {
+    if w.opaque {
+        return w.target == "" || strings.HasPrefix(p, w.target+"/")
+    }
+    return p == w.target || strings.HasPrefix(p, w.target+"/")
+}
+
+// readLayer streams one layer's regular files to jobCh and returns its
+// whiteouts. A layer that cannot be read is reported as an error finding.
+func readLayer(img *image.Image, l image.Layer, imagePath string, ignored map[string]struct{}, opts Options, jobCh chan<- imageJob) ([]layerWhiteout, *Finding) {
+    var whiteouts []layerWhiteout
+    tr, closer, err := img.OpenLayer(l)
+    if err != nil {
+        return nil, layerError(imagePath, l, err)
+    }
+    defer closer.Close()
+
+    for {
+        hdr, err := tr.Next()
+        if err == io.EOF {
+            return whiteouts, nil
+        }
+        if err != nil {
+            return whiteouts, layerError(imagePath, l, err)
+        }
+        name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+        if target, opaque, ok := image.Whiteout(name); ok {
+            whiteouts = append(whiteouts, layerWhiteout{target: target, opaque: opaque})
+            continue
+        }
+        if hdr.Typeflag != tar.TypeReg || name == "" {
+            continue
+        }
+        if inIgnoredDir(name, ignored) || inIgnoredPath(name, opts.IgnorePaths) {
+            continue
+        }
+        var r io.Reader = tr
+        if opts.MaxFileSizeBytes > 0 && hdr.Size > opts.MaxFileSizeBytes {
+            head, ok := largeArchive(tr, hdr.Size, opts)
+            if !ok {
+                jobCh <- imageJob{layer: l.Digest, name: name, size: hdr.Size, tooLarge: true}
+                continue
+            }
+            r = io.MultiReader(bytes.NewReader(head), tr)
+        }
+        data, err := io.ReadAll(r)
+        if err != nil {
+            return whiteouts, layerError(imagePath, l, err)
+        }
+        jobCh <- imageJob{layer: l.Digest, name: name, data: data}
+    }
+}
+
+// largeArchive reports whether the file over max_file_size_bytes that tr
+// is at is an archive small enough to unpack, as scanFile allows for files
+// on disk; archives are limited by max_decompressed_bytes instead. It
+// returns the bytes it had to read to tell.
+func largeArchive(tr *tar.Reader, size int64, opts Options) ([]byte, bool) {
+    if opts.MaxArchiveDepth <= 0 || size > opts.MaxArchiveBytes {
+        return nil, false
+    }
+    head := make([]byte, sniffLen)
+    n, _ := io.ReadFull(tr, head)
+    return head[:n], archiveKind(head[:n]) != ""
+}
+
+func scanImageEntry(imagePath string, j imageJob, rs *rules.RuleSet, opts Options) []Finding {
+    var out []Finding
+    if j.tooLarge {
+        p := imagePath + archivePathSep + j.name
+        out = append(out, skippedFinding(p, "skipped_size", fmt.Sprintf("file is %d bytes, over max_file_size_bytes (%d)", j.size, opts.MaxFileSizeBytes)))
+    } else if opts.MaxArchiveDepth <= 0 && archiveKind(j.data) != "" {
+        // with archive scanning off, archives in the image are skipped,
+        // and listed so the unscanned contents are not mistaken for clean
+        p := imagePath + archivePathSep + j.name
+        out = append(out, skippedFinding(p, "skipped_archive", "archive not unpacked, archives.max_depth is 0"))
+    } else {
+        budget := opts.MaxArchiveBytes
+        out = scanEntry(imagePath, j.name, j.data, rs, opts, 0, &budget)
+    }
+    for i := range out {
+        out[i].Layer = j.layer
+    }
+    return out
+}
+
+func layerError(imagePath string, l image.Layer, err error) *Finding {
+    return &Finding{
+        File:        imagePath,
+        RuleID:      "archive_error",
+        Description: "Error reading image layer: " + err.Error(),
+        Type:        "error",
+        Severity:    "low",
+        Layer:       l.Digest,
+    }
+}
@@ -0,0 +1,230 @@
+package scanner
+
+import (
+    "bytes"
+    "encoding/base64"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "superscan/internal/rules"
+)
+
+// k8sResource is one Kubernetes object in a manifest file.
+type k8sResource struct {
+    kind, namespace, name string
+    start, end            int            // lines of its YAML document, end exclusive (0 means EOF)
+    keys                  map[int]string // line -> key path of the data/stringData values on it
+    secretData            []keyValue     // Secret data values, still base64-encoded
+}
+
+func (r k8sResource) String() string {
+    if r.namespace == "" {
+        return r.kind + "/" + r.name
+    }
+    return r.kind + "/" + r.namespace + "/" + r.name
+}
+
+func (r k8sResource) contains(line int) bool {
+    return line >= r.start && (r.end == 0 || line < r.end)
+}
+
+// k8sResources finds the Kubernetes objects in a YAML stream: documents
+// with apiVersion, kind and metadata.name. Helm templates are accepted.
+func k8sResources(raw []byte) []k8sResource {
+    docs, err := yamlDocuments(raw)
+    if err != nil {
+        return nil
+    }
+    var out []k8sResource
+    for _, doc := range docs {
+        if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+            continue
+        }
+        root := doc.Content[0]
+        if n := len(out); n > 0 && out[n-1].end == 0 {
+            out[n-1].end = root.Line
+        }
+        kind := yamlString(root, "kind")
+        if kind == "" || yamlString(root, "apiVersion") == "" {
+            continue
+        }
+        meta := yamlChild(root, "metadata")
+        r := k8sResource{
+            kind:      kind,
+            namespace: helmSource(raw, yamlChild(meta, "namespace")),
+            name:      helmSource(raw, yamlChild(meta, "name")),
+            start:     root.Line,
+            keys:      make(map[int]string),
+        }
+        if kind == "Secret" || kind == "ConfigMap" {
+            for _, field := range []string{"data", "stringData"} {
+                values := yamlChild(root, field)
+                if values == nil {
+                    continue
+                }
+                for _, kv := range yamlNodeValues(values, field, "") {
+                    r.keys[kv.line] = kv.path
+                    if kind == "Secret" && field == "data" {
+                        r.secretData = append(r.secretData, kv)
+                    }
+                }
+            }
+        }
+        out = append(out, r)
+    }
+    return out
+}
+
+func yamlChild(n *yaml.Node, key string) *yaml.Node {
+    if n == nil || n.Kind != yaml.MappingNode {
+        return nil
+    }
+    for i := 0; i+1 < len(n.Content); i += 2 {
+        if n.Content[i].Value == key {
+            return n.Content[i+1]
+        }
+    }
+    return nil
+}
+
+// helmSource is the value of scalar n, except that a Helm template action
+// yamlDocuments blanked out is given as written, e.g. a name of
+// {{ include "app.fullname" . }}.
+func helmSource(raw []byte, n *yaml.Node) string {
+    if n == nil || n.Kind != yaml.ScalarNode {
+        return ""
+    }
+    if !bytes.Contains(raw, []byte("{{")) || !strings.Contains(n.Value, "xx") {
+        return n.Value
+    }
+    lines := lineOffsets(raw)
+    if n.Line < 1 || n.Line > len(lines) {
+        return n.Value
+    }
+    text := lineText(raw, lines, n.Line)
+    col := n.Column - 1
+    if n.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+        col++
+    }
+    if col < 0 || col+len(n.Value) > len(text) {
+        return n.Value
+    }
+    return text[col : col+len(n.Value)]
+}
+
+func yamlString(n *yaml.Node, key string) string {
+    if c := yamlChild(n, key); c != nil && c.Kind == yaml.ScalarNode {
+        return c.Value
+    }
+    return ""
+}
+
+// scanManifests adds Kubernetes context to the findings of a YAML file.
+// Secret data values are base64-decoded and scanned in full, since their
+// plain text appears nowhere in the file; then every finding inside an
+// object is labelled with it, and with the data key when it sits on one.
+// A decoded value the line scan's decoding stage also caught is reported
+// once.
+func scanManifests(p string, raw []byte, rs *rules.RuleSet, keep func(start, end int) bool, found []Finding) []Finding {
+    if structuredKind(p) != "yaml" {
+        return found
+    }
+    resources := k8sResources(raw)
+    if len(resources) == 0 {
+        return found
+    }
+
+    var out []Finding
+    lines := lineOffsets(raw)
+    sups := suppressionsIn(raw)
+    encodedAt := make(map[string]string) // resource and key -> encoded value
+    for _, r := range resources {
+        for _, kv := range r.secretData {
+            encoded := strings.Join(strings.Fields(kv.value), "")
+            encodedAt[r.String()+"\x00"+kv.path] = encoded
+            if keep != nil && !keep(kv.line, kv.line) {
+                continue
+            }
+            b, err := base64.StdEncoding.DecodeString(encoded)
+            if err != nil {
+                continue
+            }
+            out = append(out, scanSecretValue(p, raw, lines, r.String(), kv, encoded, string(b), rs)...)
+        }
+    }
+    applySuppressions(out, sups)
+
+    seen := make(map[string]bool)
+    for _, f := range out {
+        seen[f.RuleID+"\x00"+f.Match+"\x00"+f.KeyPath] = true
+    }
+    for _, f := range found {
+        for _, r := range resources {
+            if f.Line > 0 && r.contains(f.Line) {
+                f.Resource = r.String()
+                if f.KeyPath == "" {
+                    f.KeyPath = r.keys[f.Line]
+                }
+                break
+            }
+        }
+        if f.Resource != "" && seen[f.RuleID+"\x00"+f.Match+"\x00"+f.KeyPath] {
+            continue
+        }
+        // pattern matches of a whole Secret value still encoded (key_regex
+        // rules) are superseded by the scan of the decoded value
+        if enc, ok := encodedAt[f.Resource+"\x00"+f.KeyPath]; ok && f.Type == "pattern" && f.Decoding == nil && f.Match == enc {
+            continue
+        }
+        out = append(out, f)
+    }
+
+    return out
+}
+
+// scanSecretValue scans one decoded Secret data value with every rule,
+// and with the key_regex rules under its key, reporting the findings at
+// the encoded value in the file.
+func scanSecretValue(p string, raw []byte, lines []int, resource string, kv keyValue, encoded, decoded string, rs *rules.RuleSet) []Finding {
+    found := scanReader(p, strings.NewReader(decoded), rs)
+    for _, m := range rs.MatchValue(lastKey(kv.path), decoded) {
+        found = append(found, Finding{
+            RuleID:      m.RuleID,
+            Description: m.Description,
+            Match:       m.Match,
+            FullMatch:   m.FullMatch,
+            Type:        "pattern",
+            Severity:    m.Severity,
+            Tags:        m.Tags,
+        })
+    }
+
+    var out []Finding
+    for _, f := range found {
+        if f.Type == "error" {
+            continue
+        }
+        f.File = p
+        f.Line = kv.line
+        f.EndLine = 0
+        f.StartColumn, f.EndColumn, f.StartOffset, f.EndOffset = 0, 0, 0, 0
+        f.Resource = resource
+        f.KeyPath = kv.path
+        f.Decoding = append([]string{"base64"}, f.Decoding...)
+        f.Encoded = encoded
+        f.Snippet = trimLine(lineText(raw, lines, kv.line))
+
+        // place it on the encoded value, which is what is in the file
+        loc := Finding{Line: kv.line, Match: encoded}
+        if locateMatch(&loc, raw, lines) {
+            f.Line = loc.Line
+            f.StartColumn, f.EndColumn = loc.StartColumn, loc.EndColumn
+            f.StartOffset, f.EndOffset = loc.StartOffset, loc.EndOffset
+            col := loc.StartOffset - lines[loc.Line-1]
+            f.Snippet = snippetAt(lineText(raw, lines, loc.Line), col, col+len(encoded))
+        }
+        out = append(out, f)
+    }
+    return out
+}
@@ -0,0 +1,174 @@
+package scanner
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+
+    "superscan/internal/rules"
+)
+
+// NotebookCell places a finding inside a Jupyter notebook.
+type NotebookCell struct {
+    Index int    `json:"index"`          // 0-based, as in nbformat; -1 for the notebook's own metadata
+    Type  string `json:"type"`           // source | output | metadata
+    Line  int    `json:"line,omitempty"` // 1-based line within the cell's source or outputs
+}
+
+func (c NotebookCell) String() string {
+    switch {
+    case c.Type != "metadata":
+        return fmt.Sprintf("%d, %s line %d", c.Index, c.Type, c.Line)
+    case c.Index < 0:
+        return "notebook metadata"
+    }
+    return fmt.Sprintf("%d, metadata", c.Index)
+}
+
+// notebookPathRe picks the strings a notebook's text lives in out of the
+// key paths jsonKeyValues reports: cell sources and the text, traceback
+// and text/* data of cell outputs. Images and other data are skipped.
+var notebookPathRe = regexp.MustCompile(`^cells\[(\d+)\]\.(?:(source)|outputs\[(\d+)\]\.(?:text|(traceback)|data\.text/[^.\[]+))(?:\[\d+\])?$`)
+
+// notebookMetadataRe matches the strings in notebook and cell metadata,
+// where extensions and kernels sometimes keep connection settings.
+var notebookMetadataRe = regexp.MustCompile(`^(?:cells\[(\d+)\]\.)?metadata[.\[]`)
+
+func isNotebook(p string) bool {
+    return strings.HasSuffix(strings.ToLower(p), ".ipynb")
+}
+
+// notebookPart is the text of one cell's source, or of all its outputs
+// joined, with the file line each of its lines came from.
+type notebookPart struct {
+    cell      int
+    kind      string
+    text      strings.Builder
+    fileLines []int // by line within the part, 0-based
+    open      bool  // the last line has no newline yet
+    output    int   // last output index appended, to separate outputs
+}
+
+// add appends one JSON string read from fileLine. separate starts it on a
+// line of its own even if the text so far does not end in a newline.
+func (np *notebookPart) add(s string, fileLine int, separate bool) {
+    if s == "" {
+        return
+    }
+    if separate && np.open {
+        np.text.WriteByte('\n')
+        np.open = false
+    }
+    if !np.open {
+        np.fileLines = append(np.fileLines, fileLine)
+    }
+    for i := strings.Count(strings.TrimSuffix(s, "\n"), "\n"); i > 0; i-- {
+        np.fileLines = append(np.fileLines, fileLine)
+    }
+    np.text.WriteString(s)
+    np.open = !strings.HasSuffix(s, "\n")
+}
+
+// scanNotebook scans the code, markdown and outputs of a .ipynb file as
+// the text they hold rather than as JSON, reporting the cell and the line
+// within it. Line still refers to the notebook file, so editors and SARIF
+// viewers land on the right spot. ok is false when raw is not a notebook.
+func scanNotebook(p string, raw []byte, rs *rules.RuleSet, keep func(start, end int) bool) (out []Finding, ok bool) {
+    kvs, err := jsonKeyValues(raw)
+    if err != nil {
+        return nil, false
+    }
+
+    var parts []*notebookPart
+    byKey := make(map[string]*notebookPart)
+    for _, kv := range kvs {
+        m := notebookPathRe.FindStringSubmatch(kv.path)
+        if m == nil {
+            continue
+        }
+        cell, _ := strconv.Atoi(m[1])
+        kind := "output"
+        if m[2] != "" {
+            kind = "source"
+        }
+        key := m[1] + kind
+        np := byKey[key]
+        if np == nil {
+            np = &notebookPart{cell: cell, kind: kind, output: -1}
+            byKey[key] = np
+            parts = append(parts, np)
+        }
+        newOutput := false
+        if m[3] != "" {
+            output, _ := strconv.Atoi(m[3])
+            newOutput = output != np.output
+            np.output = output
+        }
+        // traceback entries are lines without their newline
+        np.add(kv.value, kv.line, newOutput || m[4] != "")
+    }
+
+    lines := lineOffsets(raw)
+    for _, np := range parts {
+        for _, f := range scanReader(p, strings.NewReader(np.text.String()), rs) {
+            if f.Line < 1 || f.Line > len(np.fileLines) {
+                out = append(out, f)
+                continue
+            }
+            f.Notebook = &NotebookCell{Index: np.cell, Type: np.kind, Line: f.Line}
+            f.Line = np.fileLines[f.Line-1]
+            if f.EndLine > 0 && f.EndLine <= len(np.fileLines) {
+                f.EndLine = np.fileLines[f.EndLine-1]
+            }
+            end := f.Line
+            if f.EndLine > end {
+                end = f.EndLine
+            }
+            if keep != nil && !keep(f.Line, end) {
+                continue
+            }
+            // columns and offsets only carry over where the match appears
+            // unescaped in the JSON
+            f.StartColumn, f.EndColumn, f.StartOffset, f.EndOffset = 0, 0, 0, 0
+            if f.EndLine <= f.Line {
+                f.EndLine = 0
+                locateMatch(&f, raw, lines)
+            }
+            out = append(out, f)
+        }
+    }
+    return append(out, scanNotebookMetadata(p, raw, kvs, rs, keep)...), true
+}
+
+// scanNotebookMetadata runs pattern and key_regex rules on each metadata
+// string on its own. Findings carry the value's key path.
+func scanNotebookMetadata(p string, raw []byte, kvs []keyValue, rs *rules.RuleSet, keep func(start, end int) bool) []Finding {
+    var out []Finding
+    lines := lineOffsets(raw)
+    for _, kv := range kvs {
+        m := notebookMetadataRe.FindStringSubmatch(kv.path)
+        if m == nil || keep != nil && !keep(kv.line, kv.line) {
+            continue
+        }
+        cell := -1
+        if m[1] != "" {
+            cell, _ = strconv.Atoi(m[1])
+        }
+        found := scanReader(p, strings.NewReader(kv.value), rs)
+        for i := range found {
+            f := &found[i]
+            // a JSON string sits on one line of the file
+            f.Line, f.EndLine = kv.line, 0
+            f.StartColumn, f.EndColumn, f.StartOffset, f.EndOffset = 0, 0, 0, 0
+            locateMatch(f, raw, lines)
+        }
+        found = append(found, scanKeyValues(p, raw, []keyValue{kv}, rs, nil)...)
+        for i := range found {
+            found[i].KeyPath = kv.path
+            found[i].Notebook = &NotebookCell{Index: cell, Type: "metadata"}
+        }
+        out = append(out, found...)
+    }
+    return out
+}
@@ -1,35 +1,63 @@
 package scanner
 
 import (
-    "bufio"
     "bytes"
+    "fmt"
+    "io"
     "io/fs"
     "os"
     "path/filepath"
     "strings"
     "sync"
+    "unicode/utf8"
 
+    "superscan/internal/glob"
     "superscan/internal/rules"
 )
 
 type Options struct {
     IgnoreDirs       []string
+    IgnorePaths      []string // globs relative to the scan root, for files and dirs
     MaxFileSizeBytes int64
     Workers          int
+    MaxArchiveDepth  int   // nesting levels to unpack; 0 leaves archives alone
+    MaxArchiveBytes  int64 // decompressed bytes read per top-level archive
+    NoGitignore      bool  // skip .gitignore files; .superscanignore still applies
 }
 
 type Finding struct {
-    File        string   `json:"file"`
-    Line        int      `json:"line"`
-    RuleID      string   `json:"rule_id"`
-    Description string   `json:"description"`
-    Snippet     string   `json:"snippet"`
-    Match       string   `json:"match,omitempty"`
-    Entropy     float64  `json:"entropy,omitempty"`
-    Type        string   `json:"type"` // pattern | entropy | filename | error
-    Severity    string   `json:"severity"`
-    Tags        []string `json:"tags,omitempty"`
-    Fingerprint string   `json:"fingerprint"`
+    File              string        `json:"file"`
+    Line              int           `json:"line"`
+    EndLine           int           `json:"end_line,omitempty"`
+    StartColumn       int           `json:"start_column,omitempty"`
+    EndColumn         int           `json:"end_column,omitempty"`
+    StartOffset       int           `json:"start_offset,omitempty"`
+    EndOffset         int           `json:"end_offset,omitempty"`
+    RuleID            string        `json:"rule_id"`
+    Description       string        `json:"description"`
+    Snippet           string        `json:"snippet"`
+    Match             string        `json:"match,omitempty"`
+    FullMatch         string        `json:"full_match,omitempty"` // whole regex match when the rule's secret_group narrowed Match
+    Encoded           string        `json:"encoded,omitempty"`    // the encoded form Match was decoded from
+    Decoding          []string      `json:"decoding,omitempty"`   // encodings peeled off to find Match, e.g. [base64]
+    Entropy           float64       `json:"entropy,omitempty"`
+    Type              string        `json:"type"` // pattern | entropy | filename | composite | error | skipped
+    Severity          string        `json:"severity"`
+    Tags              []string      `json:"tags,omitempty"`
+    Resource          string        `json:"resource,omitempty"` // Kubernetes manifests: Kind/namespace/name of the object
+    KeyPath           string        `json:"key_path,omitempty"` // structured files: where the value sits, e.g. database.prod.password
+    Notebook          *NotebookCell `json:"notebook,omitempty"`
+    Fingerprint       string        `json:"fingerprint"`
+    Commit            string        `json:"commit,omitempty"`
+    Author            string        `json:"author,omitempty"`
+    Email             string        `json:"email,omitempty"`
+    Date              string        `json:"date,omitempty"`
+    Layer             string        `json:"layer,omitempty"`        // image scans: digest of the layer holding the file
+    RemovedIn         string        `json:"removed_in,omitempty"`   // image scans: later layer that deletes the file
+    Related           []Finding     `json:"related,omitempty"`      // composite findings: the findings they group
+    Verification      string        `json:"verification,omitempty"` // verified | invalid | unknown
+    Suppressed        bool          `json:"suppressed,omitempty"`
+    SuppressionReason string        `json:"suppression_reason,omitempty"`
 }
 
 type job struct {
@@ -41,6 +69,9 @@ func Scan(root string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
     if opts.Workers <= 0 {
         opts.Workers = 4
     }
+    if opts.MaxArchiveBytes <= 0 {
+        opts.MaxArchiveBytes = 100 << 20
+    }
     var findingsMu sync.Mutex
     var findings []Finding
 
@@ -67,25 +98,35 @@ func Scan(root string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
         ignored[d] = struct{}{}
     }
 
+    ignoreFiles := newIgnoreRules(root, !opts.NoGitignore)
+
     var walkErr error
     err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
         if err != nil {
             walkErr = err
             return nil
         }
+        rel, _ := filepath.Rel(root, path)
+        rel = filepath.ToSlash(rel)
+        if rel == "." {
+            rel = ""
+        }
         if d.IsDir() {
             if _, ok := ignored[d.Name()]; ok {
                 return filepath.SkipDir
             }
+            if rel != "" && (matchIgnorePath(opts.IgnorePaths, rel) || ignoreFiles.ignored(rel, true)) {
+                return filepath.SkipDir
+            }
+            ignoreFiles.enter(rel, path)
             return nil
         }
-
-        info, err := d.Info()
-        if err != nil {
+        if rel != "" && (matchIgnorePath(opts.IgnorePaths, rel) || ignoreFiles.ignored(rel, false)) {
             return nil
         }
 
-        if opts.MaxFileSizeBytes > 0 && info.Size() > opts.MaxFileSizeBytes {
+        info, err := d.Info()
+        if err != nil {
             return nil
         }
 
@@ -102,88 +143,305 @@ func Scan(root string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
     return findings, walkErr
 }
 
+func matchIgnorePath(patterns []string, rel string) bool {
+    for _, p := range patterns {
+        if glob.Match(p, rel) {
+            return true
+        }
+    }
+    return false
+}
+
+// sniffLen is how much of a file is read up front to tell text, binary
+// and archives apart, the same sample looksBinary inspects.
+const sniffLen = 8000
+
 func scanFile(path string, info fs.FileInfo, rs *rules.RuleSet, opts Options) []Finding {
     var out []Finding
 
+    if rs.IsAllowlisted(path) {
+        return out
+    }
+    rs = rs.ForPath(path)
+
     if rs.IsSensitiveFilename(info.Name()) {
+        out = append(out, filenameFinding(path, info.Name()))
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        return append(out, readError(path, err))
+    }
+    defer f.Close()
+
+    head := make([]byte, sniffLen)
+    n, err := io.ReadFull(f, head)
+    if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+        return append(out, readError(path, err))
+    }
+    head = head[:n]
+
+    if opts.MaxArchiveDepth > 0 && archiveKind(head) != "" {
+        if info.Size() > opts.MaxArchiveBytes {
+            return append(out, skippedFinding(path, "skipped_size", fmt.Sprintf("archive is %d bytes, over max_decompressed_bytes (%d)", info.Size(), opts.MaxArchiveBytes)))
+        }
+        // archive formats need random access, so these are read whole
+        raw, err := io.ReadAll(io.MultiReader(bytes.NewReader(head), f))
+        if err != nil {
+            return append(out, readError(path, err))
+        }
+        return append(out, scanContent(path, raw, rs, opts)...)
+    }
+    // archives are limited by max_decompressed_bytes above, so only text
+    // files are held to max_file_size_bytes
+    if opts.MaxFileSizeBytes > 0 && info.Size() > opts.MaxFileSizeBytes {
+        return append(out, skippedFinding(path, "skipped_size", fmt.Sprintf("file is %d bytes, over max_file_size_bytes (%d)", info.Size(), opts.MaxFileSizeBytes)))
+    }
+    if looksBinary(head) {
+        return append(out, skippedFinding(path, "skipped_binary", "binary file"))
+    }
+
+    r := io.MultiReader(bytes.NewReader(head), f)
+    if needsParse(path, rs) && info.Size() <= maxStructuredBytes {
+        // parsed formats need the whole file, so read it once for both
+        raw, err := io.ReadAll(r)
+        if err != nil {
+            return append(out, readError(path, err))
+        }
+        return append(out, scanText(path, raw, rs)...)
+    }
+    return append(out, scanReader(path, r, rs)...)
+}
+
+func scanContent(path string, raw []byte, rs *rules.RuleSet, opts Options) []Finding {
+    if opts.MaxArchiveDepth > 0 && archiveKind(raw) != "" {
+        budget := opts.MaxArchiveBytes
+        return scanArchive(path, raw, rs, opts, 1, &budget)
+    }
+    return scanText(path, raw, rs)
+}
+
+func scanText(path string, raw []byte, rs *rules.RuleSet) []Finding {
+    if looksBinary(raw) {
+        // archive entries reach here unsniffed; list them like binary files
+        return []Finding{skippedFinding(path, "skipped_binary", "binary file")}
+    }
+    if isNotebook(path) && len(raw) <= maxStructuredBytes {
+        if out, ok := scanNotebook(path, raw, rs, nil); ok {
+            return out
+        }
+    }
+    out := scanReader(path, bytes.NewReader(raw), rs)
+    out = append(out, scanStructured(path, raw, rs, nil)...)
+    return scanManifests(path, raw, rs, nil, out)
+}
+
+// needsParse reports whether the file at p is read whole and parsed rather
+// than streamed: notebooks and YAML (for Kubernetes manifests) always,
+// other config files when key_regex rules exist.
+func needsParse(p string, rs *rules.RuleSet) bool {
+    kind := structuredKind(p)
+    return isNotebook(p) || kind == "yaml" || kind != "" && rs.HasKeyRules()
+}
+
+func readError(path string, err error) Finding {
+    return Finding{
+        File:        path,
+        RuleID:      "read_error",
+        Description: err.Error(),
+        Type:        "error",
+        Severity:    "low",
+    }
+}
+
+// skippedFinding records a file that was deliberately not scanned, so it
+// shows up in the report instead of silently vanishing.
+func skippedFinding(path, rule, reason string) Finding {
+    return Finding{
+        File:        path,
+        RuleID:      rule,
+        Description: "Not scanned: " + reason,
+        Type:        "skipped",
+        Severity:    "info",
+    }
+}
+
+// SplitSkipped separates skipped-file records from findings.
+func SplitSkipped(findings []Finding) (scanned, skipped []Finding) {
+    for _, f := range findings {
+        if f.Type == "skipped" {
+            skipped = append(skipped, f)
+        } else {
+            scanned = append(scanned, f)
+        }
+    }
+    return scanned, skipped
+}
+
+func filenameFinding(path, name string) Finding {
+    return Finding{
+        File:        path,
+        Line:        0,
+        RuleID:      "sensitive_filename",
+        Description: "Suspicious filename",
+        Snippet:     name,
+        Type:        "filename",
+        Severity:    "medium",
+        Tags:        []string{"filename"},
+    }
+}
+
+// scanLine matches a single line. lineOffset is the byte offset of the
+// line's first character within the file, used for StartOffset/EndOffset.
+func scanLine(path string, lineNum, lineOffset int, line string, rs *rules.RuleSet) []Finding {
+    var out []Finding
+
+    for _, m := range rs.MatchPatterns(line) {
         f := Finding{
             File:        path,
-            Line:        0,
-            RuleID:      "sensitive_filename",
-            Description: "Suspicious filename",
-            Snippet:     info.Name(),
-            Type:        "filename",
-            Severity:    "medium",
-            Tags:        []string{"filename"},
+            Line:        lineNum,
+            StartColumn: column(line, m.Start),
+            EndColumn:   column(line, m.End),
+            StartOffset: lineOffset + m.Start,
+            EndOffset:   lineOffset + m.End,
+            RuleID:      m.RuleID,
+            Description: m.Description,
+            Snippet:     snippetAt(line, m.Start, m.End),
+            Match:       m.Match,
+            FullMatch:   m.FullMatch,
+            Type:        "pattern",
+            Severity:    m.Severity,
+            Tags:        m.Tags,
         }
         out = append(out, f)
     }
 
-    raw, err := os.ReadFile(path)
-    if err != nil {
-        out = append(out, Finding{
+    // columns and offsets cover the encoded token as it is in the file
+    for _, m := range rs.MatchDecoded(line) {
+        f := Finding{
             File:        path,
-            RuleID:      "read_error",
-            Description: err.Error(),
-            Type:        "error",
-            Severity:    "low",
-        })
-        return out
+            Line:        lineNum,
+            StartColumn: column(line, m.Start),
+            EndColumn:   column(line, m.End),
+            StartOffset: lineOffset + m.Start,
+            EndOffset:   lineOffset + m.End,
+            RuleID:      m.RuleID,
+            Description: m.Description,
+            Snippet:     snippetAt(line, m.Start, m.End),
+            Match:       m.Match,
+            FullMatch:   m.FullMatch,
+            Encoded:     m.Encoded,
+            Decoding:    m.Decoding,
+            Type:        "pattern",
+            Severity:    m.Severity,
+            Tags:        m.Tags,
+        }
+        out = append(out, f)
     }
 
-    if looksBinary(raw) {
+    for _, em := range rs.MatchEntropy(line) {
+        f := Finding{
+            File:        path,
+            Line:        lineNum,
+            StartColumn: column(line, em.Start),
+            EndColumn:   column(line, em.End),
+            StartOffset: lineOffset + em.Start,
+            EndOffset:   lineOffset + em.End,
+            RuleID:      em.RuleID,
+            Description: em.Description,
+            Snippet:     snippetAt(line, em.Start, em.End),
+            Match:       em.Value,
+            Entropy:     em.Entropy,
+            Type:        "entropy",
+            Severity:    em.Severity,
+            Tags:        em.Tags,
+        }
+        out = append(out, f)
+    }
+
+    return out
+}
+
+// scanMultiline reports multiline rule matches over the whole buffer. When
+// keep is set, only blocks whose line range it accepts are reported.
+func scanMultiline(path string, raw []byte, rs *rules.RuleSet, keep func(start, end int) bool) []Finding {
+    return scanMultilineWindow(path, raw, 0, 1, 0, len(raw), rs, keep)
+}
+
+// scanMultilineWindow matches multiline rules against a window of a file
+// that starts at byte offset base and line number firstLine. firstCol is
+// how many characters of the first line precede the window, non-zero when
+// a window edge falls inside a long line. Matches that start at or after
+// limit are left for the next window.
+func scanMultilineWindow(path string, raw []byte, base, firstLine, firstCol, limit int, rs *rules.RuleSet, keep func(start, end int) bool) []Finding {
+    var out []Finding
+
+    text := string(raw)
+    matches := rs.MatchMultiline(text)
+    if len(matches) == 0 {
         return out
     }
 
-    scanner := bufio.NewScanner(bytes.NewReader(raw))
-    lineNum := 0
-    for scanner.Scan() {
-        lineNum++
-        line := scanner.Text()
-
-        for _, m := range rs.MatchPatterns(line) {
-            f := Finding{
-                File:        path,
-                Line:        lineNum,
-                RuleID:      m.RuleID,
-                Description: m.Description,
-                Snippet:     trimLine(line),
-                Match:       m.Match,
-                Type:        "pattern",
-                Severity:    m.Severity,
-                Tags:        m.Tags,
-            }
-            out = append(out, f)
-        }
-
-        for _, em := range rs.MatchEntropy(line) {
-            f := Finding{
-                File:        path,
-                Line:        lineNum,
-                RuleID:      em.RuleID,
-                Description: em.Description,
-                Snippet:     trimLine(line),
-                Match:       em.Value,
-                Entropy:     em.Entropy,
-                Type:        "entropy",
-                Severity:    em.Severity,
-                Tags:        em.Tags,
-            }
-            out = append(out, f)
+    lineStarts := lineOffsets(raw)
+
+    for _, m := range matches {
+        if m.Start >= limit && limit < len(raw) {
+            continue
+        }
+        start := lineAt(lineStarts, m.Start)
+        end := start
+        if m.End > m.Start {
+            end = lineAt(lineStarts, m.End-1)
+        }
+        if keep != nil && !keep(firstLine+start-1, firstLine+end-1) {
+            continue
+        }
+        first, _, _ := strings.Cut(m.Match, "\n")
+        startCol := column(text[lineStarts[start-1]:], m.Start-lineStarts[start-1])
+        endCol := column(text[lineStarts[end-1]:], m.End-lineStarts[end-1])
+        if start == 1 {
+            startCol += firstCol
+        }
+        if end == 1 {
+            endCol += firstCol
         }
+        f := Finding{
+            File:        path,
+            Line:        firstLine + start - 1,
+            EndLine:     firstLine + end - 1,
+            StartColumn: startCol,
+            EndColumn:   endCol,
+            StartOffset: base + m.Start,
+            EndOffset:   base + m.End,
+            RuleID:      m.RuleID,
+            Description: m.Description,
+            Snippet:     trimLine(first),
+            Match:       m.Match,
+            FullMatch:   m.FullMatch,
+            Type:        "pattern",
+            Severity:    m.Severity,
+            Tags:        m.Tags,
+        }
+        out = append(out, f)
     }
+    return out
+}
 
-    if err := scanner.Err(); err != nil {
-        out = append(out, Finding{
-            File:        path,
-            RuleID:      "scan_error",
-            Description: "Error scanning file: " + err.Error(),
-            Type:        "error",
-            Severity:    "low",
-        })
+// lineOffsets returns the byte offset at which each line of raw starts.
+func lineOffsets(raw []byte) []int {
+    starts := []int{0}
+    for i, c := range raw {
+        if c == '\n' {
+            starts = append(starts, i+1)
+        }
     }
+    return starts
+}
 
-    return out
+// column converts a byte index within a line into a 1-based column counted
+// in Unicode code points, the unit the SARIF report declares.
+func column(line string, byteIdx int) int {
+    return utf8.RuneCountInString(line[:byteIdx]) + 1
 }
 
 func looksBinary(b []byte) bool {
@@ -209,6 +467,39 @@ func looksBinary(b []byte) bool {
     return nonText > len(sample)/10
 }
 
+// snippetAt is the line trimmed for display. Lines too long to show whole
+// (minified bundles, one-line JSON) are cut down to the text around the
+// match at [start, end) so the snippet still contains the secret.
+func snippetAt(line string, start, end int) string {
+    if len(strings.TrimSpace(line)) <= 200 {
+        return trimLine(line)
+    }
+    from, to := start-snippetContext, end+snippetContext
+    if from < 0 {
+        from = 0
+    }
+    if to > len(line) {
+        to = len(line)
+    }
+    for from > 0 && !utf8.RuneStart(line[from]) {
+        from--
+    }
+    for to < len(line) && !utf8.RuneStart(line[to]) {
+        to++
+    }
+    s := strings.TrimSpace(line[from:to])
+    if from > 0 {
+        s = "..." + s
+    }
+    if to < len(line) {
+        s += "..."
+    }
+    return s
+}
+
+// snippetContext is how much text either side of a match snippetAt keeps.
+const snippetContext = 80
+
 func trimLine(s string) string {
     s = strings.TrimSpace(s)
     if len(s) > 200 {
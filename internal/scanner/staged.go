@@ -0,0 +1,57 @@
+package scanner
+
+import (
+    "superscan/internal/git"
+    "superscan/internal/rules"
+)
+
+// ScanStaged scans only the lines the index adds on top of HEAD, i.e. what
+// the next commit would introduce. Line numbers refer to the staged content.
+func ScanStaged(repoPath string, rs *rules.RuleSet, opts Options) ([]Finding, error) {
+    repo, err := git.Open(repoPath)
+    if err != nil {
+        return nil, err
+    }
+    defer repo.Close()
+
+    var headTree git.Hash
+    head, err := repo.Head()
+    if err != nil {
+        return nil, err
+    }
+    if !head.IsZero() {
+        c, err := repo.ReadCommit(head)
+        if err != nil {
+            return nil, err
+        }
+        headTree = c.Tree
+    }
+    committed, err := repo.TreeFiles(headTree)
+    if err != nil {
+        return nil, err
+    }
+
+    entries, err := repo.ReadIndex()
+    if err != nil {
+        return nil, err
+    }
+
+    ignored := make(map[string]struct{})
+    for _, d := range opts.IgnoreDirs {
+        ignored[d] = struct{}{}
+    }
+
+    var jobs []blobJob
+    for _, e := range entries {
+        if !e.IsFile() || inIgnoredDir(e.Path, ignored) || inIgnoredPath(e.Path, opts.IgnorePaths) {
+            continue
+        }
+        from := committed[e.Path]
+        if from == e.Hash {
+            continue
+        }
+        jobs = append(jobs, blobJob{change: git.Change{Path: e.Path, From: from, To: e.Hash}})
+    }
+
+    return scanBlobJobs(repo, jobs, rs, opts), nil
+}
@@ -0,0 +1,172 @@
+package scanner
+
+import (
+    "bufio"
+    "bytes"
+    "io"
+    "unicode/utf8"
+
+    "superscan/internal/rules"
+)
+
+const (
+    // multilineWindow is how much of a file multiline rules see at once.
+    // Files up to this size are matched in one piece; larger ones in
+    // windows that overlap by at least multilineOverlap. Matches starting
+    // in the overlap are left to the next window, so a block split by a
+    // window edge is still found whole if it fits in the overlap.
+    multilineWindow  = 1 << 20
+    multilineOverlap = 64 << 10
+)
+
+// longLineWindow is the most of one line scanned at a time. Longer lines
+// (minified JS, one-line JSON bundles) are scanned in windows that overlap
+// by longLineOverlap; as with multiline windows, matches starting in the
+// overlap are left to the next window, so secrets shorter than the overlap
+// are never split.
+const (
+    longLineWindow  = 64 << 10
+    longLineOverlap = 4 << 10
+)
+
+// scanReader scans text line by line as it is read, holding at most one
+// multiline window of it in memory.
+func scanReader(path string, r io.Reader, rs *rules.RuleSet) []Finding {
+    var out []Finding
+
+    sups := make(map[int]suppression)
+    var win []byte
+    winOffset, winLine, winCol := 0, 1, 0
+
+    // seg is the unscanned part of the current line; segOffset and segCol
+    // are its byte offset in the file and the characters before it on the
+    // line
+    var seg []byte
+    segOffset, segCol := 0, 0
+    var lw *longLine
+
+    br := bufio.NewReaderSize(r, longLineWindow)
+    lineNum := 1
+    var readErr error
+    for {
+        chunk, err := br.ReadSlice('\n')
+        seg = append(seg, chunk...)
+        win = append(win, chunk...)
+
+        if err == bufio.ErrBufferFull {
+            // the line goes on past the buffer; scan what we have of it
+            // and carry the overlap into the next window
+            if lw == nil {
+                lw = &longLine{covered: make(map[string]int)}
+            }
+            cut := runeCut(seg, len(seg)-longLineOverlap)
+            out = append(out, lw.scan(path, lineNum, segOffset, segCol, string(seg), cut, rs, sups)...)
+            segCol += utf8.RuneCount(seg[:cut])
+            segOffset += cut
+            seg = append(seg[:0], seg[cut:]...)
+        } else if len(seg) > 0 {
+            line := string(trimEOL(seg))
+            if lw != nil {
+                out = append(out, lw.scan(path, lineNum, segOffset, segCol, line, len(line), rs, sups)...)
+            } else {
+                if sup, ok := parseSuppression(line, lineNum); ok {
+                    sups[lineNum] = sup
+                }
+                out = append(out, scanLine(path, lineNum, segOffset, line, rs)...)
+            }
+            lineNum++
+            segOffset += len(seg)
+            segCol = 0
+            seg = seg[:0]
+            lw = nil
+        }
+
+        if len(win) >= multilineWindow {
+            // start the overlap at a line start where there is one, so the
+            // next window's line numbers and columns stay exact; it may
+            // grow to twice multilineOverlap for that, but never shrinks
+            cut := runeCut(win, len(win)-multilineOverlap)
+            if nl := bytes.LastIndexByte(win[len(win)-2*multilineOverlap:cut], '\n'); nl >= 0 {
+                cut = len(win) - 2*multilineOverlap + nl + 1
+            }
+            out = append(out, scanMultilineWindow(path, win, winOffset, winLine, winCol, cut, rs, nil)...)
+            if nl := bytes.LastIndexByte(win[:cut], '\n'); nl >= 0 {
+                winLine += bytes.Count(win[:cut], []byte{'\n'})
+                winCol = utf8.RuneCount(win[nl+1 : cut])
+            } else {
+                winCol += utf8.RuneCount(win[:cut])
+            }
+            winOffset += cut
+            win = append(win[:0], win[cut:]...)
+        }
+
+        if err != nil && err != bufio.ErrBufferFull {
+            if err != io.EOF {
+                readErr = err
+            }
+            break
+        }
+    }
+    out = append(out, scanMultilineWindow(path, win, winOffset, winLine, winCol, len(win), rs, nil)...)
+
+    if readErr != nil {
+        out = append(out, Finding{
+            File:        path,
+            RuleID:      "scan_error",
+            Description: "Error scanning file: " + readErr.Error(),
+            Type:        "error",
+            Severity:    "low",
+        })
+    }
+
+    applySuppressions(out, sups)
+    return out
+}
+
+// longLine tracks one line too long to scan in one piece.
+type longLine struct {
+    // covered is, per rule, the file offset where the last reported match
+    // ended. A match that started before a window edge is reported whole
+    // by the window it started in; the next window would otherwise also
+    // see its tail, which can match on its own (entropy tokens do).
+    covered map[string]int
+}
+
+// scan matches one window of a long line. text starts at file offset
+// offset, col characters into the line; matches starting at or after
+// limit are left for the next window.
+func (lw *longLine) scan(path string, lineNum, offset, col int, text string, limit int, rs *rules.RuleSet, sups map[int]suppression) []Finding {
+    var out []Finding
+    if _, ok := sups[lineNum]; !ok {
+        if sup, ok := parseSuppression(text, lineNum); ok {
+            sups[lineNum] = sup
+        }
+    }
+    for _, f := range scanLine(path, lineNum, offset, text, rs) {
+        if f.StartOffset-offset >= limit || f.StartOffset < lw.covered[f.RuleID] {
+            continue
+        }
+        lw.covered[f.RuleID] = f.EndOffset
+        f.StartColumn += col
+        f.EndColumn += col
+        out = append(out, f)
+    }
+    return out
+}
+
+// runeCut moves i back to the start of the UTF-8 sequence it falls in, so
+// a window edge never splits a character.
+func runeCut(b []byte, i int) int {
+    if i <= 0 {
+        return 0
+    }
+    for i > 0 && i < len(b) && !utf8.RuneStart(b[i]) {
+        i--
+    }
+    return i
+}
+
+func trimEOL(line []byte) []byte {
+    line = bytes.TrimSuffix(line, []byte{'\n'})
+    return bytes.TrimSuffix(line, []byte{'\r'})
+}
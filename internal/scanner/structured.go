@@ -0,0 +1,496 @@
+package scanner
+
+import (
+    "bytes"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "path"
+    "regexp"
+    "sort"
+    "strings"
+
+    "gopkg.in/yaml.v3"
+
+    "superscan/internal/rules"
+)
+
+// maxStructuredBytes is the largest file parsed for key-aware rules.
+// Parsing needs the whole file in memory; bigger files are still scanned
+// line by line.
+const maxStructuredBytes = 10 << 20
+
+// keyValue is one string value read from a structured file.
+type keyValue struct {
+    path  string // from the document root, e.g. database.prod.password
+    key   string // the value's own key, password in the example above
+    value string
+    line  int // line the value starts on
+}
+
+// structuredKind tells from a file name which parser reads it, or "" for
+// files that are only scanned line by line.
+func structuredKind(name string) string {
+    name = strings.ToLower(path.Base(name))
+    switch path.Ext(name) {
+    case ".json":
+        return "json"
+    case ".yaml", ".yml":
+        return "yaml"
+    case ".toml":
+        return "toml"
+    case ".properties":
+        return "properties"
+    case ".ini", ".cfg":
+        return "ini"
+    case ".env":
+        return "env"
+    }
+    if name == ".env" || strings.HasPrefix(name, ".env.") {
+        return "env"
+    }
+    return ""
+}
+
+func extractKeyValues(kind string, raw []byte) ([]keyValue, error) {
+    switch kind {
+    case "json":
+        return jsonKeyValues(raw)
+    case "yaml":
+        return yamlKeyValues(raw)
+    case "toml":
+        return tomlKeyValues(raw), nil
+    case "properties":
+        return propertiesKeyValues(raw), nil
+    case "ini":
+        return iniKeyValues(raw), nil
+    case "env":
+        return envKeyValues(raw), nil
+    }
+    return nil, nil
+}
+
+// scanStructured matches key_regex rules against the values of a JSON,
+// YAML, TOML, .env, .properties or INI file. Files that do not parse are
+// left to the line scan. When keep is set, only values on lines it
+// accepts are reported.
+func scanStructured(p string, raw []byte, rs *rules.RuleSet, keep func(line int) bool) []Finding {
+    kind := structuredKind(p)
+    if kind == "" || len(raw) > maxStructuredBytes || !rs.HasKeyRules() {
+        return nil
+    }
+    kvs, err := extractKeyValues(kind, raw)
+    if err != nil {
+        return nil
+    }
+    return scanKeyValues(p, raw, kvs, rs, keep)
+}
+
+// scanKeyValues reports key_regex rule matches in kvs, placed at the spot
+// in raw where the matched text appears.
+func scanKeyValues(p string, raw []byte, kvs []keyValue, rs *rules.RuleSet, keep func(line int) bool) []Finding {
+    var out []Finding
+    lines := lineOffsets(raw)
+    for _, kv := range kvs {
+        if keep != nil && !keep(kv.line) {
+            continue
+        }
+        for _, m := range rs.MatchValue(kv.key, kv.value) {
+            f := Finding{
+                File:        p,
+                Line:        kv.line,
+                RuleID:      m.RuleID,
+                Description: m.Description,
+                Match:       m.Match,
+                FullMatch:   m.FullMatch,
+                Type:        "pattern",
+                Severity:    m.Severity,
+                Tags:        m.Tags,
+                KeyPath:     kv.path,
+            }
+            locateValue(&f, raw, lines)
+            out = append(out, f)
+        }
+    }
+    applySuppressions(out, suppressionsIn(raw))
+    return out
+}
+
+// locateValue finds f.Match in raw from f.Line on and fills in columns,
+// offsets and the snippet. Values whose source form differs from the
+// parsed one (escapes, folded block scalars) keep only the line.
+func locateValue(f *Finding, raw []byte, lines []int) {
+    if f.Line < 1 || f.Line > len(lines) {
+        return
+    }
+    if !locateMatch(f, raw, lines) {
+        f.Snippet = trimLine(lineText(raw, lines, f.Line))
+        return
+    }
+    col := f.StartOffset - lines[f.Line-1]
+    f.Snippet = snippetAt(lineText(raw, lines, f.Line), col, col+len(f.Match))
+}
+
+// locateMatch moves f to the first occurrence of f.Match in raw at or
+// after the start of f.Line, setting its line, columns and offsets. It
+// reports false, leaving f alone, if the match is not found as is.
+func locateMatch(f *Finding, raw []byte, lines []int) bool {
+    if f.Match == "" || strings.Contains(f.Match, "\n") || f.Line < 1 || f.Line > len(lines) {
+        return false
+    }
+    i := bytes.Index(raw[lines[f.Line-1]:], []byte(f.Match))
+    if i < 0 {
+        return false
+    }
+    start := lines[f.Line-1] + i
+    f.Line = lineAt(lines, start)
+    text := lineText(raw, lines, f.Line)
+    col := start - lines[f.Line-1]
+    f.StartColumn = column(text, col)
+    f.EndColumn = column(text, col+len(f.Match))
+    f.StartOffset = start
+    f.EndOffset = start + len(f.Match)
+    return true
+}
+
+func lineText(raw []byte, lines []int, line int) string {
+    end := len(raw)
+    if line < len(lines) {
+        end = lines[line]
+    }
+    return string(trimEOL(raw[lines[line-1]:end]))
+}
+
+func lineAt(lines []int, off int) int {
+    return sort.Search(len(lines), func(i int) bool { return lines[i] > off })
+}
+
+func joinKey(parent, key string) string {
+    if parent == "" {
+        return key
+    }
+    return parent + "." + key
+}
+
+func jsonKeyValues(raw []byte) ([]keyValue, error) {
+    var out []keyValue
+    lines := lineOffsets(raw)
+    dec := json.NewDecoder(bytes.NewReader(raw))
+    dec.UseNumber()
+
+    var walk func(p, key string) error
+    walk = func(p, key string) error {
+        tok, err := dec.Token()
+        if err != nil {
+            return err
+        }
+        switch t := tok.(type) {
+        case json.Delim:
+            if t == '{' {
+                for dec.More() {
+                    kt, err := dec.Token()
+                    if err != nil {
+                        return err
+                    }
+                    k, _ := kt.(string)
+                    if err := walk(joinKey(p, k), k); err != nil {
+                        return err
+                    }
+                }
+            } else {
+                // array elements keep the key of the array itself
+                for i := 0; dec.More(); i++ {
+                    if err := walk(fmt.Sprintf("%s[%d]", p, i), key); err != nil {
+                        return err
+                    }
+                }
+            }
+            _, err := dec.Token()
+            return err
+        case string:
+            // InputOffset is just past the closing quote, and JSON strings
+            // cannot span lines
+            out = append(out, keyValue{path: p, key: key, value: t, line: lineAt(lines, int(dec.InputOffset())-1)})
+        }
+        return nil
+    }
+    for {
+        err := walk("", "")
+        if err == io.EOF {
+            return out, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+    }
+}
+
+func yamlKeyValues(raw []byte) ([]keyValue, error) {
+    docs, err := yamlDocuments(raw)
+    if err != nil {
+        return nil, err
+    }
+    var out []keyValue
+    for _, doc := range docs {
+        out = append(out, yamlNodeValues(doc, "", "")...)
+    }
+    return out, nil
+}
+
+// helmActionRe matches a Go template action such as {{ .Values.x }}.
+var helmActionRe = regexp.MustCompile(`\{\{.*?\}\}`)
+
+// yamlDocuments parses every document of a YAML stream. Helm templates are
+// made parseable first: lines holding only template actions ({{- if }},
+// {{- end }}) are blanked and inline actions become x's of the same
+// length, so line numbers and columns still match the file.
+func yamlDocuments(raw []byte) ([]*yaml.Node, error) {
+    if bytes.Contains(raw, []byte("{{")) {
+        lines := strings.Split(string(raw), "\n")
+        for i, line := range lines {
+            if strings.TrimSpace(helmActionRe.ReplaceAllString(line, "")) == "" {
+                lines[i] = ""
+                continue
+            }
+            lines[i] = helmActionRe.ReplaceAllStringFunc(line, func(a string) string {
+                return strings.Repeat("x", len(a))
+            })
+        }
+        raw = []byte(strings.Join(lines, "\n"))
+    }
+
+    var docs []*yaml.Node
+    dec := yaml.NewDecoder(bytes.NewReader(raw))
+    for {
+        doc := new(yaml.Node)
+        err := dec.Decode(doc)
+        if errors.Is(err, io.EOF) {
+            return docs, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        docs = append(docs, doc)
+    }
+}
+
+func yamlNodeValues(n *yaml.Node, p, key string) []keyValue {
+    var out []keyValue
+    switch n.Kind {
+    case yaml.DocumentNode:
+        for _, c := range n.Content {
+            out = append(out, yamlNodeValues(c, p, key)...)
+        }
+    case yaml.MappingNode:
+        for i := 0; i+1 < len(n.Content); i += 2 {
+            k := n.Content[i].Value
+            out = append(out, yamlNodeValues(n.Content[i+1], joinKey(p, k), k)...)
+        }
+    case yaml.SequenceNode:
+        for i, c := range n.Content {
+            out = append(out, yamlNodeValues(c, fmt.Sprintf("%s[%d]", p, i), key)...)
+        }
+    case yaml.ScalarNode:
+        // numbers and booleans are not secrets
+        if n.ShortTag() == "!!str" {
+            line, value := n.Line, n.Value
+            if n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+                // block scalars start below their indicator and keep a
+                // final newline that is not part of the secret
+                line++
+                value = strings.TrimRight(value, "\n")
+            }
+            out = append(out, keyValue{path: p, key: key, value: value, line: line})
+        }
+    }
+    return out
+}
+
+// tomlKeyValues reads the subset of TOML that holds credentials: tables,
+// arrays of tables and key = "string" pairs with bare, quoted or dotted
+// keys. Multi-line strings, arrays and inline tables are left to the line
+// scan.
+func tomlKeyValues(raw []byte) []keyValue {
+    var out []keyValue
+    table := ""
+    arrays := make(map[string]int)
+    for i, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+        switch {
+        case line == "" || line[0] == '#':
+            continue
+        case strings.HasPrefix(line, "[["):
+            name := tomlKey(strings.TrimSuffix(strings.TrimPrefix(cutComment(line), "[["), "]]"))
+            table = fmt.Sprintf("%s[%d]", name, arrays[name])
+            arrays[name]++
+            continue
+        case line[0] == '[':
+            table = tomlKey(strings.TrimSuffix(strings.TrimPrefix(cutComment(line), "["), "]"))
+            continue
+        }
+        k, v, ok := strings.Cut(line, "=")
+        if !ok {
+            continue
+        }
+        value, ok := tomlString(strings.TrimSpace(v))
+        if !ok {
+            continue
+        }
+        keyPath := tomlKey(k)
+        out = append(out, keyValue{path: joinKey(table, keyPath), key: lastKey(keyPath), value: value, line: i + 1})
+    }
+    return out
+}
+
+// tomlKey normalizes a possibly dotted, possibly quoted key to a.b.c.
+func tomlKey(s string) string {
+    var parts []string
+    for _, part := range strings.Split(s, ".") {
+        part = strings.TrimSpace(part)
+        part = strings.Trim(part, `"'`)
+        parts = append(parts, part)
+    }
+    return strings.Join(parts, ".")
+}
+
+func lastKey(keyPath string) string {
+    if i := strings.LastIndexByte(keyPath, '.'); i >= 0 {
+        return keyPath[i+1:]
+    }
+    return keyPath
+}
+
+func tomlString(v string) (string, bool) {
+    if strings.HasPrefix(v, `"""`) || strings.HasPrefix(v, "'''") {
+        return "", false
+    }
+    if strings.HasPrefix(v, "'") {
+        end := strings.IndexByte(v[1:], '\'')
+        if end < 0 {
+            return "", false
+        }
+        return v[1 : end+1], true
+    }
+    if strings.HasPrefix(v, `"`) {
+        return quotedPrefix(v)
+    }
+    return "", false
+}
+
+// quotedPrefix unquotes the double-quoted string v starts with, ignoring
+// anything after it such as a trailing comment.
+func quotedPrefix(v string) (string, bool) {
+    for i := 1; i < len(v); i++ {
+        switch v[i] {
+        case '\\':
+            i++
+        case '"':
+            var s string
+            if err := json.Unmarshal([]byte(v[:i+1]), &s); err != nil {
+                return v[1:i], true
+            }
+            return s, true
+        }
+    }
+    return "", false
+}
+
+func cutComment(s string) string {
+    if i := strings.IndexByte(s, '#'); i >= 0 {
+        s = s[:i]
+    }
+    return strings.TrimSpace(s)
+}
+
+// propertiesKeyValues reads Java .properties: key=value, key: value or
+// key value, with # and ! comments and backslash line continuations.
+func propertiesKeyValues(raw []byte) []keyValue {
+    var out []keyValue
+    lines := strings.Split(string(raw), "\n")
+    for i := 0; i < len(lines); i++ {
+        start := i
+        line := strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+        if line == "" || line[0] == '#' || line[0] == '!' {
+            continue
+        }
+        for strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) && i+1 < len(lines) {
+            i++
+            line = line[:len(line)-1] + strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t\f")
+        }
+        end := strings.IndexAny(line, "=: \t")
+        if end < 0 {
+            continue
+        }
+        key := line[:end]
+        value := strings.TrimLeft(line[end:], " \t")
+        if value != "" && (value[0] == '=' || value[0] == ':') {
+            value = strings.TrimLeft(value[1:], " \t")
+        }
+        out = append(out, keyValue{path: key, key: lastKey(key), value: value, line: start + 1})
+    }
+    return out
+}
+
+// iniKeyValues reads INI files: [section] headers and key = value or
+// key: value pairs, with ; and # comments.
+func iniKeyValues(raw []byte) []keyValue {
+    var out []keyValue
+    section := ""
+    for i, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+        if line == "" || line[0] == ';' || line[0] == '#' {
+            continue
+        }
+        if line[0] == '[' {
+            section = strings.TrimSpace(strings.Trim(line, "[]"))
+            continue
+        }
+        end := strings.IndexAny(line, "=:")
+        if end < 0 {
+            continue
+        }
+        key := strings.TrimSpace(line[:end])
+        value := unquote(strings.TrimSpace(line[end+1:]))
+        out = append(out, keyValue{path: joinKey(section, key), key: key, value: value, line: i + 1})
+    }
+    return out
+}
+
+// envKeyValues reads dotenv files: KEY=value lines, optionally prefixed
+// with export, with quoted values and # comments.
+func envKeyValues(raw []byte) []keyValue {
+    var out []keyValue
+    for i, line := range strings.Split(string(raw), "\n") {
+        line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+        if line == "" || line[0] == '#' {
+            continue
+        }
+        line = strings.TrimPrefix(line, "export ")
+        key, value, ok := strings.Cut(line, "=")
+        if !ok {
+            continue
+        }
+        key = strings.TrimSpace(key)
+        value = strings.TrimSpace(value)
+        switch {
+        case strings.HasPrefix(value, `"`):
+            value, _ = quotedPrefix(value)
+        case strings.HasPrefix(value, "'"):
+            value, _ = tomlString(value)
+        default:
+            if j := strings.Index(value, " #"); j >= 0 {
+                value = strings.TrimSpace(value[:j])
+            }
+        }
+        out = append(out, keyValue{path: key, key: key, value: value, line: i + 1})
+    }
+    return out
+}
+
+func unquote(v string) string {
+    if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+        return v[1 : len(v)-1]
+    }
+    return v
+}
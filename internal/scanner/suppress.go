@@ -0,0 +1,115 @@
+package scanner
+
+import (
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+const suppressDirective = "superscan:ignore"
+
+var suppressRuleRe = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// suppression is a parsed `superscan:ignore [rule,...] [-- reason]` comment.
+// It covers its own line, and the line after it when the comment stands on
+// a line of its own; no rules means all rules.
+type suppression struct {
+    line    int
+    ownLine bool
+    rules   map[string]bool
+    reason  string
+}
+
+func parseSuppression(line string, lineNum int) (suppression, bool) {
+    i := strings.Index(line, suppressDirective)
+    if i < 0 {
+        return suppression{}, false
+    }
+    rest := line[i+len(suppressDirective):]
+    if rest != "" && rest[0] != ' ' && rest[0] != '\t' && !strings.HasPrefix(rest, "*/") && !strings.HasPrefix(rest, "-->") {
+        return suppression{}, false
+    }
+    rest = strings.TrimSpace(rest)
+    rest = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(rest, "*/"), "-->"))
+
+    s := suppression{line: lineNum, ownLine: strings.Trim(line[:i], commentChars) == ""}
+    ids, reason, _ := strings.Cut(rest, "--")
+    s.reason = strings.TrimSpace(reason)
+    ids = strings.TrimSpace(ids)
+    if ids == "" {
+        return s, true
+    }
+    rules := make(map[string]bool)
+    for _, id := range strings.Split(ids, ",") {
+        id = strings.TrimSpace(id)
+        if !suppressRuleRe.MatchString(id) {
+            // not a rule list but a reason written without --; it
+            // suppresses every rule, as a bare directive does
+            rules = nil
+            s.reason = strings.TrimSpace(ids + " " + s.reason)
+            break
+        }
+        rules[id] = true
+    }
+    s.rules = rules
+    return s, true
+}
+
+// commentChars are what may come before a directive on a line that holds
+// nothing but the comment: whitespace and comment markers.
+const commentChars = " \t#/*<!-;%'"
+
+// suppressionsIn parses every suppression comment in raw, by line.
+func suppressionsIn(raw []byte) map[int]suppression {
+    sups := make(map[int]suppression)
+    for i, line := range strings.Split(string(raw), "\n") {
+        if sup, ok := parseSuppression(strings.TrimSuffix(line, "\r"), i+1); ok {
+            sups[i+1] = sup
+        }
+    }
+    return sups
+}
+
+func (s suppression) covers(f Finding) bool {
+    if f.Line != s.line && !(s.ownLine && f.Line == s.line+1) {
+        return false
+    }
+    return s.rules == nil || s.rules[f.RuleID]
+}
+
+// applySuppressions marks findings covered by an inline directive. They are
+// kept so that suppressions can be audited.
+func applySuppressions(findings []Finding, sups map[int]suppression) {
+    if len(sups) == 0 {
+        return
+    }
+    for i := range findings {
+        f := &findings[i]
+        if f.Line == 0 {
+            continue
+        }
+        for _, l := range []int{f.Line, f.Line - 1} {
+            s, ok := sups[l]
+            if !ok || !s.covers(*f) {
+                continue
+            }
+            f.Suppressed = true
+            f.SuppressionReason = s.reason
+            if f.SuppressionReason == "" {
+                f.SuppressionReason = fmt.Sprintf("%s on line %d", suppressDirective, s.line)
+            }
+            break
+        }
+    }
+}
+
+func SplitSuppressed(findings []Finding) (active, suppressed []Finding) {
+    for _, f := range findings {
+        if f.Suppressed {
+            suppressed = append(suppressed, f)
+        } else {
+            active = append(active, f)
+        }
+    }
+    return active, suppressed
+}
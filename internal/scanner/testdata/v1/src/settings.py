@@ -0,0 +1,2 @@
+AZURE_TENANT = "contoso"
+client_secret = "Qx7~Lp2vR9tZk4Wm8Yc3Hn6Bd1Fg5Js0Ua"
@@ -0,0 +1,115 @@
+package verify
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "regexp"
+    "time"
+)
+
+// An access key ID alone cannot be checked; it is tried against every
+// 40-character secret candidate found in the same file.
+var awsSecretRe = regexp.MustCompile(`(?:^|[^A-Za-z0-9/+])([A-Za-z0-9/+]{40})(?:$|[^A-Za-z0-9/+=])`)
+
+const awsSTSBody = "Action=GetCallerIdentity&Version=2011-06-15"
+
+type awsVerifier struct {
+    client   *http.Client
+    endpoint string
+}
+
+func (v *awsVerifier) Verify(ctx context.Context, c Candidate) (Status, error) {
+    seen := make(map[string]bool)
+    for _, f := range c.Related {
+        for _, m := range awsSecretRe.FindAllStringSubmatch(f.Match, -1) {
+            secret := m[1]
+            if seen[secret] {
+                continue
+            }
+            seen[secret] = true
+
+            status, err := v.try(ctx, c.Secret, secret)
+            if err != nil {
+                return StatusUnknown, err
+            }
+            // a signature mismatch means the key ID exists but this is not
+            // its secret, so keep looking
+            if status != "" {
+                return status, nil
+            }
+        }
+    }
+    return StatusUnknown, nil
+}
+
+func (v *awsVerifier) try(ctx context.Context, keyID, secret string) (Status, error) {
+    u, err := url.Parse(v.endpoint + "/")
+    if err != nil {
+        return StatusUnknown, err
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader([]byte(awsSTSBody)))
+    if err != nil {
+        return StatusUnknown, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+    signSTS(req, u.Host, keyID, secret, time.Now().UTC())
+
+    resp, err := v.client.Do(req)
+    if err != nil {
+        return StatusUnknown, err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+    if err != nil {
+        return StatusUnknown, err
+    }
+
+    switch {
+    case resp.StatusCode == http.StatusOK:
+        return StatusVerified, nil
+    case bytes.Contains(body, []byte("InvalidClientTokenId")):
+        return StatusInvalid, nil
+    case bytes.Contains(body, []byte("SignatureDoesNotMatch")):
+        return "", nil
+    }
+    return StatusUnknown, nil
+}
+
+// signSTS applies AWS Signature Version 4 for the STS GetCallerIdentity call.
+func signSTS(req *http.Request, host, keyID, secret string, now time.Time) {
+    const region, service = "us-east-1", "sts"
+    amzDate := now.Format("20060102T150405Z")
+    date := now.Format("20060102")
+    req.Header.Set("X-Amz-Date", amzDate)
+
+    payloadHash := sha256.Sum256([]byte(awsSTSBody))
+    signedHeaders := "content-type;host;x-amz-date"
+    canonical := fmt.Sprintf("POST\n/\n\ncontent-type:%s\nhost:%s\nx-amz-date:%s\n\n%s\n%s",
+        req.Header.Get("Content-Type"), host, amzDate, signedHeaders, hex.EncodeToString(payloadHash[:]))
+
+    scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+    canonicalHash := sha256.Sum256([]byte(canonical))
+    toSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(canonicalHash[:]))
+
+    key := hmacSHA256([]byte("AWS4"+secret), date)
+    key = hmacSHA256(key, region)
+    key = hmacSHA256(key, service)
+    key = hmacSHA256(key, "aws4_request")
+    signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+    req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    h := hmac.New(sha256.New, key)
+    h.Write([]byte(data))
+    return h.Sum(nil)
+}
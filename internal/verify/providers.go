@@ -0,0 +1,102 @@
+package verify
+
+import (
+    "context"
+    "encoding/json"
+    "io"
+    "net/http"
+    "strings"
+)
+
+// httpVerifier covers providers that accept the token on a single
+// authenticated request and answer 2xx for live credentials.
+type httpVerifier struct {
+    client   *http.Client
+    method   string
+    url      string
+    auth     func(req *http.Request, secret string)
+    classify func(resp *http.Response, body []byte) Status
+}
+
+func newProvider(name, base string, client *http.Client) Verifier {
+    base = strings.TrimRight(base, "/")
+    bearer := func(req *http.Request, secret string) {
+        req.Header.Set("Authorization", "Bearer "+secret)
+    }
+
+    switch name {
+    case "aws":
+        return &awsVerifier{client: client, endpoint: base}
+    case "github":
+        return &httpVerifier{client: client, method: http.MethodGet, url: base + "/user", auth: bearer, classify: byStatus}
+    case "slack":
+        return &httpVerifier{client: client, method: http.MethodPost, url: base + "/auth.test", auth: bearer, classify: slackStatus}
+    case "stripe":
+        return &httpVerifier{
+            client: client,
+            method: http.MethodGet,
+            url:    base + "/v1/balance",
+            auth: func(req *http.Request, secret string) {
+                req.SetBasicAuth(secret, "")
+            },
+            classify: byStatus,
+        }
+    case "npm":
+        return &httpVerifier{client: client, method: http.MethodGet, url: base + "/-/whoami", auth: bearer, classify: byStatus}
+    case "sendgrid":
+        return &httpVerifier{client: client, method: http.MethodGet, url: base + "/v3/scopes", auth: bearer, classify: byStatus}
+    }
+    return nil
+}
+
+func (v *httpVerifier) Verify(ctx context.Context, c Candidate) (Status, error) {
+    req, err := http.NewRequestWithContext(ctx, v.method, v.url, nil)
+    if err != nil {
+        return StatusUnknown, err
+    }
+    req.Header.Set("User-Agent", "superscan-verify")
+    v.auth(req, c.Secret)
+
+    resp, err := v.client.Do(req)
+    if err != nil {
+        return StatusUnknown, err
+    }
+    defer resp.Body.Close()
+    body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+    if err != nil {
+        return StatusUnknown, err
+    }
+    return v.classify(resp, body), nil
+}
+
+func byStatus(resp *http.Response, _ []byte) Status {
+    switch {
+    case resp.StatusCode >= 200 && resp.StatusCode < 300:
+        return StatusVerified
+    case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+        return StatusInvalid
+    }
+    return StatusUnknown
+}
+
+// slack answers 200 either way and reports the outcome in the body.
+func slackStatus(resp *http.Response, body []byte) Status {
+    if resp.StatusCode != http.StatusOK {
+        return StatusUnknown
+    }
+    var out struct {
+        OK    bool   `json:"ok"`
+        Error string `json:"error"`
+    }
+    if err := json.Unmarshal(body, &out); err != nil {
+        return StatusUnknown
+    }
+    if out.OK {
+        return StatusVerified
+    }
+    switch out.Error {
+    case "invalid_auth", "account_inactive", "token_revoked", "not_authed":
+        return StatusInvalid
+    }
+    return StatusUnknown
+}
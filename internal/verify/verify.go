@@ -0,0 +1,202 @@
+package verify
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "superscan/internal/scanner"
+)
+
+type Status string
+
+const (
+    StatusVerified Status = "verified"
+    StatusInvalid  Status = "invalid"
+    StatusUnknown  Status = "unknown"
+)
+
+// Candidate is one secret to check. Related holds the other findings from
+// the same file, for providers whose credentials come in pairs (AWS).
+type Candidate struct {
+    RuleID  string
+    Secret  string
+    Related []scanner.Finding
+}
+
+type Verifier interface {
+    Verify(ctx context.Context, c Candidate) (Status, error)
+}
+
+type Config struct {
+    Enabled        bool              `yaml:"enabled"`
+    TimeoutSeconds int               `yaml:"timeout_seconds"`
+    Workers        int               `yaml:"workers"`
+    Endpoints      map[string]string `yaml:"endpoints"`
+    Rules          map[string]string `yaml:"rules"` // rule id -> verifier name
+}
+
+var defaultEndpoints = map[string]string{
+    "aws":      "https://sts.amazonaws.com",
+    "github":   "https://api.github.com",
+    "slack":    "https://slack.com/api",
+    "stripe":   "https://api.stripe.com",
+    "npm":      "https://registry.npmjs.org",
+    "sendgrid": "https://api.sendgrid.com",
+}
+
+var defaultRules = map[string]string{
+    "aws_access_key":          "aws",
+    "github_pat":              "github",
+    "github_fine_grained_pat": "github",
+    "slack_token":             "slack",
+    "stripe_live_key":         "stripe",
+    "npm_token":               "npm",
+    "sendgrid_api_key":        "sendgrid",
+}
+
+type Engine struct {
+    verifiers map[string]Verifier
+    timeout   time.Duration
+    workers   int
+}
+
+// NewEngine builds verifiers for the built-in providers, with endpoints and
+// the rule mapping taken from cfg on top of the defaults.
+func NewEngine(cfg Config, client *http.Client) (*Engine, error) {
+    if client == nil {
+        client = &http.Client{}
+    }
+    e := &Engine{
+        verifiers: make(map[string]Verifier),
+        timeout:   10 * time.Second,
+        workers:   4,
+    }
+    if cfg.TimeoutSeconds > 0 {
+        e.timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+    }
+    if cfg.Workers > 0 {
+        e.workers = cfg.Workers
+    }
+
+    endpoints := make(map[string]string, len(defaultEndpoints))
+    for name, url := range defaultEndpoints {
+        endpoints[name] = url
+    }
+    for name, url := range cfg.Endpoints {
+        if _, ok := endpoints[name]; !ok {
+            return nil, fmt.Errorf("unknown verifier %q in endpoints", name)
+        }
+        endpoints[name] = url
+    }
+
+    providers := make(map[string]Verifier, len(endpoints))
+    for name, url := range endpoints {
+        providers[name] = newProvider(name, url, client)
+    }
+
+    mapping := make(map[string]string, len(defaultRules))
+    for id, name := range defaultRules {
+        mapping[id] = name
+    }
+    for id, name := range cfg.Rules {
+        mapping[id] = name
+    }
+    for id, name := range mapping {
+        if name == "" {
+            continue
+        }
+        v, ok := providers[name]
+        if !ok {
+            return nil, fmt.Errorf("rule %s: unknown verifier %q", id, name)
+        }
+        e.verifiers[id] = v
+    }
+    return e, nil
+}
+
+// Register maps a rule ID to a custom Verifier, replacing any built-in one.
+func (e *Engine) Register(ruleID string, v Verifier) {
+    e.verifiers[ruleID] = v
+}
+
+// Run sets Verification on every finding whose rule has a verifier. Each
+// distinct secret is checked once; errors leave the finding unknown. The
+// parts of a composite finding are checked too, and it is verified when
+// any of them is.
+func (e *Engine) Run(ctx context.Context, findings []scanner.Finding) {
+    var all []*scanner.Finding
+    for i := range findings {
+        all = append(all, &findings[i])
+        for j := range findings[i].Related {
+            all = append(all, &findings[i].Related[j])
+        }
+    }
+    byFile := make(map[string][]scanner.Finding)
+    for _, f := range all {
+        if len(f.Related) == 0 {
+            byFile[f.File] = append(byFile[f.File], *f)
+        }
+    }
+
+    type key struct{ rule, secret string }
+    var mu sync.Mutex
+    results := make(map[key]Status)
+    pending := make(map[key][]*scanner.Finding)
+    var order []key
+
+    for _, f := range all {
+        if _, ok := e.verifiers[f.RuleID]; !ok || f.Match == "" {
+            continue
+        }
+        k := key{f.RuleID, f.Match}
+        if _, ok := pending[k]; !ok {
+            order = append(order, k)
+        }
+        pending[k] = append(pending[k], f)
+    }
+
+    jobCh := make(chan key)
+    var wg sync.WaitGroup
+    for i := 0; i < e.workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for k := range jobCh {
+                first := pending[k][0]
+                c := Candidate{RuleID: k.rule, Secret: k.secret, Related: byFile[first.File]}
+
+                cctx, cancel := context.WithTimeout(ctx, e.timeout)
+                status, err := e.verifiers[k.rule].Verify(cctx, c)
+                cancel()
+                if err != nil || status == "" {
+                    status = StatusUnknown
+                }
+
+                mu.Lock()
+                results[k] = status
+                mu.Unlock()
+            }
+        }()
+    }
+    for _, k := range order {
+        jobCh <- k
+    }
+    close(jobCh)
+    wg.Wait()
+
+    for k, fs := range pending {
+        for _, f := range fs {
+            f.Verification = string(results[k])
+        }
+    }
+    for i := range findings {
+        for _, r := range findings[i].Related {
+            if r.Verification == string(StatusVerified) {
+                findings[i].Verification = r.Verification
+            }
+        }
+    }
+}